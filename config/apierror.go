@@ -28,6 +28,20 @@ func (e *APIError) SetMsg() {
 		e.Msg = "Room error: Unauthorized operation"
 	case 105:
 		e.Msg = "Room error: Invalid content"
+	case 106:
+		e.Msg = "Room error: Invalid query parameter"
+	case 107:
+		e.Msg = "Room error: Message not found"
+	case 108:
+		e.Msg = "Room error: Attachment not found"
+	case 109:
+		e.Msg = "Room error: Attachment too large"
+	case 110:
+		e.Msg = "Room error: Unsupported attachment type"
+	case 111:
+		e.Msg = "Room error: User banned"
+	case 112:
+		e.Msg = "Room error: User muted"
 	case 201:
 		e.Msg = "Client error: User not found"
 	case 202:
@@ -36,6 +50,8 @@ func (e *APIError) SetMsg() {
 		e.Msg = "Client error: Invalid JSON"
 	case 204:
 		e.Msg = "Client error: Unauthorized operation"
+	case 205:
+		e.Msg = "Client error: Invalid content"
 	case 301:
 		e.Msg = "Could not establish session"
 	case 303:
@@ -50,6 +66,8 @@ func (e *APIError) SetMsg() {
 		e.Msg = "Token error: Unauthorized signing method"
 	case 403:
 		e.Msg = "Token error: Invalid token"
+	case 404:
+		e.Msg = "Token error: Revoked token"
 	default:
 		e.Msg = "Unknown error: " + e.Msg
 	}
@@ -2,9 +2,11 @@ package config
 
 import (
 	"api_chat/models"
+	"crypto/rand"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/oklog/ulid/v2"
 )
 
 const (
@@ -12,22 +14,27 @@ const (
 	minimumRefreshDurationAllowedMinutes int = 300 // TODO: Change to 5 minutes?
 )
 
-// Claims is a model that represents JSON web tokens used for authentication by users
+// Claims is a model that represents JSON web tokens used for authentication by users.
+// Session tokens of registered users carry no RoomID. Every token has a unique ID (jti) so it can be revoked.
 type Claims struct {
 	Username string `json:"username"`
 	RoomID   int    `json:"room_id,omitempty"`
+	// Role of the user in the room when the token was issued or renewed
+	Role string `json:"role,omitempty"`
 	jwt.StandardClaims
 }
 
 //EncodeJWT will generate a jwt token based
-func EncodeJWT(c *models.ChatEvent, cr *models.ChatRoom, secretKey string) (tokenString string, err error) {
+func EncodeJWT(c *models.ChatEvent, cr *models.ChatRoom, role string, secretKey string) (tokenString string, err error) {
 	// Declare the expiration time of the token
 	expirationTime := time.Now().Add(time.Duration(expirationConstantMinutes) * time.Minute)
 	// Create the JWT claims, which includes the username and expiry time
 	claims := &Claims{
 		Username: c.User,
 		RoomID:   cr.ID,
+		Role:     role,
 		StandardClaims: jwt.StandardClaims{
+			Id: newTokenID(),
 			// In JWT, the expiry time is expressed as unix milliseconds
 			ExpiresAt: expirationTime.Unix(),
 		},
@@ -40,6 +47,36 @@ func EncodeJWT(c *models.ChatEvent, cr *models.ChatRoom, secretKey string) (toke
 	return
 }
 
+// EncodeSessionJWT will generate a jwt token identifying a registered user outside of any room
+func EncodeSessionJWT(username string, secretKey string) (tokenString string, err error) {
+	expirationTime := time.Now().Add(time.Duration(expirationConstantMinutes) * time.Minute)
+	claims := &Claims{
+		Username: username,
+		StandardClaims: jwt.StandardClaims{
+			Id:        newTokenID(),
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secretKey))
+}
+
+// Revoke refuses a token until it expires
+func (c Claims) Revoke() error {
+	if c.Id == "" {
+		return &APIError{
+			Code:  403,
+			Field: "jti",
+		}
+	}
+	return Revocations.Revoke(c.Id, time.Unix(c.ExpiresAt, 0))
+}
+
+// newTokenID returns a unique token ID
+func newTokenID() string {
+	return ulid.MustNew(ulid.Timestamp(time.Now()), rand.Reader).String()
+}
+
 // ParseJWT parses a JWT and stores Claims object in c
 func ParseJWT(tokenString string, c *Claims, secretKey string) (err error) {
 	// Parse the JWT string and store the result in `claims`.
@@ -71,6 +108,19 @@ func ParseJWT(tokenString string, c *Claims, secretKey string) (err error) {
 				Field: "token",
 			}
 		}
+		// Tokens issued before they had an ID cannot be revoked, they expire on their own
+		if c.Id != "" {
+			revoked, err := Revocations.IsRevoked(c.Id)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return &APIError{
+					Code:  404,
+					Field: "token",
+				}
+			}
+		}
 	default:
 		err = &APIError{
 			Code:  403,
@@ -90,9 +140,11 @@ func (c Claims) RefreshJWT(secretKey string) (tokenString string, err error) {
 			Field: "token",
 		}
 	}
-	// Now, create a new token with a renewed expiration time
+	// Now, create a new token with a renewed expiration time. It gets an ID of its own, revoking
+	// one of them must not revoke the other.
 	newExpirationTime := time.Now().Add(time.Duration(expirationConstantMinutes) * time.Minute)
 	c.ExpiresAt = newExpirationTime.Unix()
+	c.Id = newTokenID()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
 	return token.SignedString([]byte(secretKey))
 }
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// RevocationList keeps the IDs (jti) of tokens revoked before they expire. Entries are only needed
+// until then, Prune drops the ones past their expiry.
+type RevocationList interface {
+	// Revoke refuses the token with the given ID from now until it expires
+	Revoke(jti string, expiresAt time.Time) error
+	// IsRevoked reports whether the token with the given ID was revoked
+	IsRevoked(jti string) (bool, error)
+	// Prune drops the entries of tokens expired at now
+	Prune(now time.Time) error
+}
+
+// Revocations is the RevocationList consulted by ParseJWT. It defaults to an in-memory list,
+// swap it for a persistent one to keep revocations across restarts and server instances.
+var Revocations RevocationList = NewRevocationLog()
+
+// RevocationLog is the in-memory RevocationList
+type RevocationLog struct {
+	revoked map[string]time.Time
+	mu      sync.RWMutex
+}
+
+// NewRevocationLog returns an empty in-memory RevocationList
+func NewRevocationLog() *RevocationLog {
+	return &RevocationLog{revoked: make(map[string]time.Time)}
+}
+
+// Revoke refuses the token with the given ID from now until it expires
+func (l *RevocationLog) Revoke(jti string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked reports whether the token with the given ID was revoked
+func (l *RevocationLog) IsRevoked(jti string) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.revoked[jti]
+	return ok, nil
+}
+
+// Prune drops the entries of tokens expired at now
+func (l *RevocationLog) Prune(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for jti, expiresAt := range l.revoked {
+		if !expiresAt.After(now) {
+			delete(l.revoked, jti)
+		}
+	}
+	return nil
+}
+
+// PruneRevocations prunes Revocations every interval. It never returns.
+func PruneRevocations(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := Revocations.Prune(now); err != nil {
+			Warning("error pruning revoked tokens", err.Error())
+		}
+	}
+}
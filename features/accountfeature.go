@@ -0,0 +1,40 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"regexp"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// usernamePattern allows the characters @mentions can refer to
+var usernamePattern = regexp.MustCompile(`^[\p{L}\p{N}_.\-]{2,32}$`)
+
+// IsRegistered reports whether username belongs to a registered account.
+// It is set up by the server once the account store is opened.
+var IsRegistered = func(username string) bool { return false }
+
+// IsValidAccount validates the username and password of an account to be registered
+func IsValidAccount(a models.Account) (err *config.APIError, validity bool) {
+	if !usernamePattern.MatchString(a.Username) {
+		return &config.APIError{
+			Code:  205,
+			Field: "username",
+		}, false
+	}
+	// bcrypt ignores anything past 72 bytes
+	if len(a.Password) < 8 || len(a.Password) > 72 {
+		return &config.APIError{
+			Code:  205,
+			Field: "password",
+		}, false
+	}
+	return nil, true
+}
+
+// MatchesAccountPassword reports whether val is the password of the account
+func MatchesAccountPassword(val string, a models.Account) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(a.Password), []byte(val))
+	return err == nil
+}
@@ -0,0 +1,41 @@
+package features
+
+import (
+	"api_chat/models"
+	"mime"
+	"strings"
+)
+
+// maxAttachments limits the number of files a message can share
+const maxAttachments = 10
+
+var (
+	// MaxAttachmentSize is the largest file in bytes that can be uploaded to a room
+	MaxAttachmentSize int64 = 10 << 20
+	// AttachmentTypes are the MIME types of the files that can be uploaded to a room
+	AttachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"}
+)
+
+// AttachmentAllowed reports whether files of contentType can be uploaded. Parameters such as the charset are ignored.
+func AttachmentAllowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range AttachmentTypes {
+		if allowedType, _, err := mime.ParseMediaType(allowed); err == nil && strings.EqualFold(mediaType, allowedType) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAttachments ensures the files a message shares were uploaded to its room
+func checkAttachments(evt *models.ChatEvent, cr *models.ChatRoom) error {
+	for _, id := range evt.Attachments {
+		if _, err := cr.Attachments.Get(cr.ID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
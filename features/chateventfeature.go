@@ -3,22 +3,77 @@ package features
 import (
 	"api_chat/config"
 	"api_chat/models"
+	"crypto/rand"
 	"encoding/json"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	// maxClientMsgIDLength limits the size of the client_msg_id echoed back to clients
+	maxClientMsgIDLength = 64
+	// maxEmojiLength limits the size of a reaction, leaving room for sequences with modifiers
+	maxEmojiLength = 32
+	// maxRecipients limits the number of users a direct message is sent to
+	maxRecipients = 16
 )
 
+var (
+	entropy   = ulid.Monotonic(rand.Reader, 0)
+	entropyMu sync.Mutex
+)
+
+// NewEventID returns a unique ULID. IDs generated by this process sort in order of creation.
+func NewEventID() string {
+	entropyMu.Lock()
+	defer entropyMu.Unlock()
+	return ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
+}
+
 // ValidateEvent ensures data is a valid JSON representation of Chat Event and can be parsed as such
 func ValidateEvent(data []byte) (models.ChatEvent, error) {
+	return ValidateEventAs(data, "")
+}
+
+// ValidateEventAs validates an event sent by an authenticated user, whose name replaces the one in data.
+// Anonymous senders, with an empty identity, may not use the name of a registered user.
+func ValidateEventAs(data []byte, identity string) (models.ChatEvent, error) {
 	var evt models.ChatEvent
 
 	if err := json.Unmarshal(data, &evt); err != nil {
 		return evt, &config.APIError{Code: 303}
 	}
+	if identity != "" {
+		evt.User = identity
+	} else if evt.User != "" && IsRegistered(evt.User) {
+		return evt, &config.APIError{Code: 204, Field: "name"}
+	}
+
+	eventType := strings.ToLower(evt.EventType)
+	targeted := eventType == models.Edit || eventType == models.Delete || eventType == models.React || eventType == models.Unreact
+	reaction := eventType == models.React || eventType == models.Unreact
 
 	if evt.User == "" {
 		return evt, &config.APIError{Code: 303, Field: "name"}
-	} else if evt.Msg == "" && strings.ToLower(evt.EventType) == models.Broadcast {
+	} else if evt.Msg == "" && len(evt.Attachments) == 0 && eventType == models.Broadcast {
+		return evt, &config.APIError{Code: 303, Field: "msg"}
+	} else if evt.Msg == "" && (eventType == models.Edit || eventType == models.DirectMessage) {
 		return evt, &config.APIError{Code: 303, Field: "msg"}
+	} else if evt.TargetID == "" && targeted {
+		return evt, &config.APIError{Code: 303, Field: "target_id"}
+	} else if (evt.Emoji == "" || len(evt.Emoji) > maxEmojiLength) && reaction {
+		return evt, &config.APIError{Code: 303, Field: "emoji"}
+	} else if (len(evt.Recipients) == 0 || len(evt.Recipients) > maxRecipients) && eventType == models.DirectMessage {
+		return evt, &config.APIError{Code: 303, Field: "to"}
+	} else if evt.ReadSeq <= 0 && eventType == models.Receipt {
+		return evt, &config.APIError{Code: 303, Field: "read_seq"}
+	} else if len(evt.ClientMsgID) > maxClientMsgIDLength {
+		return evt, &config.APIError{Code: 303, Field: "client_msg_id"}
+	} else if len(evt.Attachments) > maxAttachments {
+		return evt, &config.APIError{Code: 303, Field: "attachments"}
 	}
 
 	return evt, nil
@@ -0,0 +1,66 @@
+package features
+
+import (
+	"api_chat/config"
+	"strings"
+	"testing"
+)
+
+func TestValidateEvent(t *testing.T) {
+	cases := []struct {
+		name          string
+		data          string
+		expectedField string
+	}{
+		{"valid", `{"event_type":"send","name":"alice","msg":"hi","client_msg_id":"local-1"}`, ""},
+		{"invalid JSON", `{"event_type":`, ""},
+		{"missing name", `{"event_type":"send","msg":"hi"}`, "name"},
+		{"missing msg", `{"event_type":"send","name":"alice"}`, "msg"},
+		{"edit without target", `{"event_type":"edit","name":"alice","msg":"hi"}`, "target_id"},
+		{"reaction without emoji", `{"event_type":"react","name":"alice","target_id":"01H"}`, "emoji"},
+		{"dm without recipients", `{"event_type":"dm","name":"alice","msg":"hi"}`, "to"},
+		{"receipt without read_seq", `{"event_type":"receipt","name":"alice"}`, "read_seq"},
+		{"too many attachments", `{"event_type":"send","name":"alice","attachments":["1","2","3","4","5","6","7","8","9","10","11"]}`, "attachments"},
+		{"long client_msg_id", `{"event_type":"send","name":"alice","msg":"hi","client_msg_id":"` + strings.Repeat("x", 65) + `"}`, "client_msg_id"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			evt, err := ValidateEvent([]byte(tc.data))
+			if tc.name == "valid" {
+				if err != nil || evt.ClientMsgID != "local-1" {
+					t.Errorf("Unexpected result %+v (%v)", evt, err)
+				}
+				return
+			}
+			if apierr, ok := err.(*config.APIError); !ok || apierr.Code != 303 || apierr.Field != tc.expectedField {
+				t.Errorf("Unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateEventAs(t *testing.T) {
+	IsRegistered = func(username string) bool { return username == "alice" }
+	defer func() { IsRegistered = func(string) bool { return false } }()
+	evt, err := ValidateEventAs([]byte(`{"event_type":"send","name":"mallory","msg":"hi"}`), "alice")
+	if err != nil || evt.User != "alice" {
+		t.Errorf("Expected the authenticated name to be used, got %+v (%v)", evt, err)
+	}
+	if _, err = ValidateEventAs([]byte(`{"event_type":"send","msg":"hi"}`), "alice"); err != nil {
+		t.Errorf("Authenticated events need no name, got %v", err)
+	}
+	if _, err = ValidateEvent([]byte(`{"event_type":"send","name":"alice","msg":"hi"}`)); err == nil || err.(*config.APIError).Code != 204 {
+		t.Errorf("Expected anonymous use of a registered name to be refused, got %v", err)
+	}
+}
+
+func TestNewEventID(t *testing.T) {
+	previous := NewEventID()
+	for i := 0; i < 1000; i++ {
+		id := NewEventID()
+		if id <= previous {
+			t.Fatalf("Event IDs are not increasing: %s <= %s", id, previous)
+		}
+		previous = id
+	}
+}
@@ -5,19 +5,41 @@ import (
 	"api_chat/models"
 	"encoding/json"
 	"golang.org/x/crypto/bcrypt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
+// clientsMu guards the Clients maps of the rooms, shared by the read pumps of their clients and API requests.
+// Rooms are passed around by value, so the lock is kept here rather than in each room.
+var clientsMu sync.RWMutex
+
 // ToJSON marshals a ChatRoom object in a JSON encoding that can be returned to users
 func ToJSON(cr models.ChatRoom) (jsonEncoding []byte, err error) {
 	// Populate client slice. TODO: Can this be simplified?
-	clientsSlice := make([]models.Client, len(cr.Clients))
-	var i int = 0
+	clientsMu.RLock()
+	clients := make([]*models.Client, 0, len(cr.Clients))
 	for _, v := range cr.Clients {
-		//clientsSlice = append(clientsSlice, *v)
-		clientsSlice[i] = *v
+		clients = append(clients, v)
+	}
+	clientsMu.RUnlock()
+	clientsSlice := make([]models.Client, len(clients))
+	var i int = 0
+	now := time.Now()
+	for _, v := range clients {
+		// Copy the public fields only, the activity of connected clients is changing
+		lastActivity, _ := v.Activity()
+		clientsSlice[i] = models.Client{
+			Username:     v.Username,
+			Color:        v.Color,
+			LastActivity: lastActivity,
+			Presence:     Presence(v, now),
+		}
 		i++
 	}
+	// The roles may change while they are encoded
+	cr.Roles = cr.GrantedRoles()
 	// Create new JSON struct with clients
 	jsonEncoding, err = json.Marshal(struct {
 		*models.ChatRoom
@@ -31,6 +53,8 @@ func ToJSON(cr models.ChatRoom) (jsonEncoding []byte, err error) {
 
 //AddClient will add a user to a ChatRoom
 func AddClient(c *models.Client, cr models.ChatRoom) (err error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
 	if clientExists(c.Username, cr) {
 		return &config.APIError{
 			Code:  202,
@@ -38,17 +62,21 @@ func AddClient(c *models.Client, cr models.ChatRoom) (err error) {
 		}
 	}
 	cr.Clients[strings.ToLower(c.Username)] = c
+	register(c)
 	return
 }
 
 // RemoveClient will remove a user from a ChatRoom
 func RemoveClient(user string, cr models.ChatRoom) (err error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
 	if !clientExists(user, cr) {
 		return &config.APIError{
 			Code:  201,
 			Field: user,
 		}
 	}
+	unregister(cr.Clients[strings.ToLower(user)])
 	delete(cr.Clients, strings.ToLower(user))
 	return
 }
@@ -58,6 +86,12 @@ func Authorize(c *models.ChatEvent, cr models.ChatRoom) bool {
 	return MatchesPassword(c.Password, cr)
 }
 
+// Reauthenticate disconnects all clients of a room whose password changed. Their tokens were signed with
+// the previous one, they must request new tokens before joining again.
+func Reauthenticate(cr *models.ChatRoom) {
+	cr.Broker.DisconnectAll(models.CloseReauthenticate, "room password changed")
+}
+
 // IsValid validates a chat room fields are still valid
 func IsValid(cr models.ChatRoom) (err *config.APIError, validity bool) {
 	// Title should be at least 2 characters
@@ -105,6 +139,7 @@ func MatchesPassword(val string, cr models.ChatRoom) bool {
 	return err == nil
 }
 
+// clientExists reports whether a user joined a room. Callers must hold clientsMu.
 func clientExists(name string, cr models.ChatRoom) bool {
 	name = strings.ToLower(name)
 	for k := range cr.Clients {
@@ -115,6 +150,29 @@ func clientExists(name string, cr models.ChatRoom) bool {
 	return false
 }
 
+// lookupClient returns the client a user joined a room with
+func lookupClient(name string, cr models.ChatRoom) (*models.Client, bool) {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	c, ok := cr.Clients[strings.ToLower(name)]
+	return c, ok
+}
+
+// reachable returns the name to address a user of a room by. Users are reachable when they joined the room
+// on this server instance, or hold an account and may have joined it on another one.
+func reachable(name string, cr models.ChatRoom) (string, bool) {
+	if c, ok := lookupClient(name, cr); ok {
+		return c.Username, true
+	}
+	return name, IsRegistered(name)
+}
+
+// isMember reports whether c is the client its user joined its room with
+func isMember(c *models.Client) bool {
+	member, ok := lookupClient(c.Username, *c.Room)
+	return ok && member == c
+}
+
 // PrettyTime prints the creation date in a pretty format
 func PrettyTime(cr models.ChatRoom) string {
 	layout := "Mon Jan _2 15:04"
@@ -123,5 +181,81 @@ func PrettyTime(cr models.ChatRoom) string {
 
 // Participants prints the # of active clients
 func Participants(cr models.ChatRoom) int {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
 	return len(cr.Clients)
 }
+
+const (
+	// SortCreated orders rooms by creation date
+	SortCreated = "created"
+	// SortUpdated orders rooms by date of last update
+	SortUpdated = "updated"
+	// SortParticipants orders rooms by number of active clients
+	SortParticipants = "participants"
+)
+
+// RoomQuery selects, orders and pages the rooms returned by ListRooms
+type RoomQuery struct {
+	Visibility string
+	Title      string
+	Sort       string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// ListRooms filters and sorts rooms according to q. It returns the requested page and the total number of matches
+func ListRooms(rooms []models.ChatRoom, q RoomQuery) (page []models.ChatRoom, total int) {
+	title := strings.ToLower(q.Title)
+	matches := make([]models.ChatRoom, 0, len(rooms))
+	for _, cr := range rooms {
+		if q.Visibility != "" && cr.Type != q.Visibility {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(cr.Title), title) {
+			continue
+		}
+		matches = append(matches, cr)
+	}
+	// Clients come and go while sorting, count them once
+	participants := make(map[int]int, len(matches))
+	if q.Sort == SortParticipants {
+		for _, cr := range matches {
+			participants[cr.ID] = Participants(cr)
+		}
+	}
+	// Rooms are ordered by ID on ties so pages stay stable
+	less := func(a, b models.ChatRoom) bool {
+		switch q.Sort {
+		case SortUpdated:
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt)
+			}
+		case SortParticipants:
+			if participants[a.ID] != participants[b.ID] {
+				return participants[a.ID] < participants[b.ID]
+			}
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if q.Descending {
+			return less(matches[j], matches[i])
+		}
+		return less(matches[i], matches[j])
+	})
+	total = len(matches)
+	if q.Offset >= total {
+		return matches[:0], total
+	}
+	matches = matches[q.Offset:]
+	if q.Limit < len(matches) {
+		matches = matches[:q.Limit]
+	}
+	return matches, total
+}
@@ -0,0 +1,68 @@
+package features
+
+import (
+	"api_chat/models"
+	"testing"
+	"time"
+)
+
+func TestListRooms(t *testing.T) {
+	now := time.Now()
+	rooms := []models.ChatRoom{
+		{ID: 1, Title: "Public Chat", Type: models.PublicRoom, CreatedAt: now, UpdatedAt: now.Add(3 * time.Minute), Clients: map[string]*models.Client{"a": {}}},
+		{ID: 2, Title: "Go chat", Type: models.PublicRoom, CreatedAt: now.Add(time.Minute), UpdatedAt: now.Add(time.Minute), Clients: map[string]*models.Client{"a": {}, "b": {}, "c": {}}},
+		{ID: 3, Title: "Private chat", Type: models.PrivateRoom, CreatedAt: now.Add(2 * time.Minute), UpdatedAt: now.Add(2 * time.Minute), Clients: map[string]*models.Client{}},
+		{ID: 4, Title: "Random", Type: models.PublicRoom, CreatedAt: now.Add(2 * time.Minute), UpdatedAt: now, Clients: map[string]*models.Client{"a": {}, "b": {}}},
+	}
+	cases := []struct {
+		name          string
+		query         RoomQuery
+		expectedIDs   []int
+		expectedTotal int
+	}{
+		{"default order", RoomQuery{Limit: 10}, []int{1, 2, 3, 4}, 4},
+		{"newest first", RoomQuery{Limit: 10, Descending: true}, []int{4, 3, 2, 1}, 4},
+		{"visibility", RoomQuery{Visibility: models.PrivateRoom, Limit: 10}, []int{3}, 1},
+		{"title substring", RoomQuery{Title: "CHAT", Limit: 10}, []int{1, 2, 3}, 3},
+		{"updated", RoomQuery{Sort: SortUpdated, Limit: 10}, []int{4, 2, 3, 1}, 4},
+		{"participants", RoomQuery{Sort: SortParticipants, Descending: true, Limit: 10}, []int{2, 4, 1, 3}, 4},
+		{"second page", RoomQuery{Limit: 2, Offset: 2}, []int{3, 4}, 4},
+		{"past last page", RoomQuery{Limit: 2, Offset: 4}, []int{}, 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, total := ListRooms(rooms, tc.query)
+			if total != tc.expectedTotal || len(page) != len(tc.expectedIDs) {
+				t.Fatalf("Expected %d of %d rooms, got %d of %d", len(tc.expectedIDs), tc.expectedTotal, len(page), total)
+			}
+			for i, cr := range page {
+				if cr.ID != tc.expectedIDs[i] {
+					t.Errorf("Expected room %d at position %d, got %d", tc.expectedIDs[i], i, cr.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestListRoomsWhileJoining(t *testing.T) {
+	cr := &models.ChatRoom{ID: 1, Title: "Public Chat", Type: models.PublicRoom, Clients: make(map[string]*models.Client)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c := &models.Client{Username: "alice", Room: cr}
+			if err := AddClient(c, *cr); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := RemoveClient("alice", *cr); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		ListRooms([]models.ChatRoom{*cr, {ID: 2, Title: "Go chat", Clients: map[string]*models.Client{}}}, RoomQuery{Sort: SortParticipants, Limit: 10})
+	}
+	<-done
+}
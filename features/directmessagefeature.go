@@ -0,0 +1,37 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+)
+
+// SendDirect stores a private message of c and delivers it to its Recipients and back to the sender,
+// on whichever server instance they are connected to
+func SendDirect(evt *models.ChatEvent, c *models.Client) error {
+	if c.Username == "" {
+		return &config.APIError{Code: 204, Field: "name"}
+	}
+	if err := silenced(c.Room, c.Username); err != nil {
+		return err
+	}
+	recipients := make([]string, 0, len(evt.Recipients))
+	for _, name := range evt.Recipients {
+		recipient, ok := reachable(name, *c.Room)
+		if !ok {
+			return &config.APIError{Code: 201, Field: name}
+		}
+		recipients = append(recipients, recipient)
+	}
+	evt.EventType = models.DirectMessage
+	evt.User = c.Username
+	evt.Color = c.Color
+	evt.RoomID = c.Room.ID
+	evt.Recipients = recipients
+	// Never store or relay the room password
+	evt.Password = ""
+	if err := c.Room.Conversations.Append(evt); err != nil {
+		return err
+	}
+	c.Room.Broker.SendTo(formatEventData(evt), append(recipients, c.Username)...)
+	return nil
+}
@@ -0,0 +1,63 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"testing"
+	"time"
+)
+
+// recordingConversations is a ConversationStore keeping the direct messages appended to it
+type recordingConversations struct {
+	models.ConversationStore
+	appended []models.ChatEvent
+}
+
+func (s *recordingConversations) Append(evt *models.ChatEvent) error {
+	s.appended = append(s.appended, *evt)
+	return nil
+}
+
+func TestSendDirectRecipients(t *testing.T) {
+	IsRegistered = func(username string) bool { return username == "carol" }
+	defer func() { IsRegistered = func(string) bool { return false } }()
+	conversations := &recordingConversations{}
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client),
+		Conversations: conversations}
+	go cr.Broker.Listen()
+	alice := &models.Client{Username: "alice", Room: cr, Outbox: models.NewOutbox(4, models.DropOldest)}
+	cr.Clients["alice"] = alice
+	cr.Broker.OpenClient <- alice
+	cases := []struct {
+		name      string
+		recipient string
+		code      int
+	}{
+		// carol holds an account and may be connected to another server instance
+		{"registered user", "carol", 0},
+		{"unknown user", "nobody", 201},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := SendDirect(&models.ChatEvent{Msg: "hi", Recipients: []string{tc.recipient}}, alice)
+			if tc.code == 0 {
+				if err != nil {
+					t.Fatal("Unexpected error", err)
+				}
+				select {
+				case <-alice.Outbox.Ready():
+					alice.Outbox.Drain()
+				case <-time.After(time.Second):
+					t.Error("Sender did not receive their message back")
+				}
+				return
+			}
+			if apierr, ok := err.(*config.APIError); !ok || apierr.Code != tc.code {
+				t.Errorf("Expected error %d, got %v", tc.code, err)
+			}
+		})
+	}
+	if len(conversations.appended) != 1 || conversations.appended[0].Recipients[0] != "carol" {
+		t.Errorf("Unexpected stored messages %+v", conversations.appended)
+	}
+}
@@ -0,0 +1,72 @@
+package features
+
+import (
+	"api_chat/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventStream pumps messages from the broker to a Server-Sent Events stream until done is closed.
+//
+// Events carrying a sequence number are sent with it as their ID, so browsers can resume
+// from it using the Last-Event-ID header after losing the connection.
+func EventStream(w io.Writer, flush func(), c *models.Client, done <-chan struct{}) {
+	ticker := time.NewTicker(models.PingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Outbox.Ready():
+			for _, message := range c.Outbox.Drain() {
+				if err := writeEvent(w, message); err != nil {
+					log.Printf("Error writing event. Error: %s", err.Error())
+					return
+				}
+			}
+			flush()
+		case <-c.Outbox.Done():
+			// Tell the client why, since streams have no close codes
+			if code, text := c.Outbox.CloseReason(); code != websocket.CloseNormalClosure {
+				if err := writeClose(w, code, text); err == nil {
+					flush()
+				}
+			}
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			// Comment lines keep proxies from timing out idle streams
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flush()
+		}
+	}
+}
+
+// writeClose sends the close code and text of the Outbox as a "close" event
+func writeClose(w io.Writer, code int, text string) (err error) {
+	data, _ := json.Marshal(struct {
+		Code   int    `json:"code"`
+		Reason string `json:"reason"`
+	}{code, text})
+	_, err = fmt.Fprintf(w, "event: close\ndata: %s\n\n", data)
+	return
+}
+
+func writeEvent(w io.Writer, message []byte) (err error) {
+	var evt struct {
+		Seq int `json:"seq"`
+	}
+	if err = json.Unmarshal(message, &evt); err == nil && evt.Seq > 0 {
+		if _, err = fmt.Fprintf(w, "id: %d\n", evt.Seq); err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", message)
+	return
+}
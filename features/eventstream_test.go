@@ -0,0 +1,73 @@
+package features
+
+import (
+	"api_chat/models"
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while EventStream writes to it
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestEventStream(t *testing.T) {
+	c := &models.Client{Outbox: models.NewOutbox(10, models.DropOldest)}
+	w := &syncBuffer{}
+	flushed := make(chan bool, 10)
+	done := make(chan struct{})
+	finished := make(chan bool)
+	go func() {
+		EventStream(w, func() { flushed <- true }, c, done)
+		finished <- true
+	}()
+	c.Outbox.Push([]byte(`{"event_type":"join","name":"alice"}`))
+	c.Outbox.Push([]byte(`{"event_type":"send","name":"alice","msg":"hi","seq":7}`))
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("Events were not flushed")
+	}
+	close(done)
+	<-finished
+	expected := "data: {\"event_type\":\"join\",\"name\":\"alice\"}\n\n" +
+		"id: 7\ndata: {\"event_type\":\"send\",\"name\":\"alice\",\"msg\":\"hi\",\"seq\":7}\n\n"
+	if w.String() != expected {
+		t.Errorf("Expected stream %q, got %q", expected, w.String())
+	}
+}
+
+func TestEventStreamClose(t *testing.T) {
+	c := &models.Client{Outbox: models.NewOutbox(10, models.DropOldest)}
+	w := &syncBuffer{}
+	finished := make(chan bool)
+	go func() {
+		EventStream(w, func() {}, c, make(chan struct{}))
+		finished <- true
+	}()
+	c.Outbox.CloseWith(models.CloseReauthenticate, "room password changed")
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("Stream did not end")
+	}
+	expected := "event: close\ndata: {\"code\":4002,\"reason\":\"room password changed\"}\n\n"
+	if w.String() != expected {
+		t.Errorf("Expected stream %q, got %q", expected, w.String())
+	}
+}
@@ -0,0 +1,86 @@
+package features
+
+import (
+	"api_chat/models"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// mentionPattern matches @username, usernames are taken to end at the first whitespace or punctuation other than . _ -
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_.\-]+)`)
+
+var (
+	// sessions tracks the clients of every user across all rooms, by lower case username
+	sessions   = make(map[string]map[*models.Client]bool)
+	sessionsMu sync.Mutex
+)
+
+// register adds c to the sessions of its user
+func register(c *models.Client) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	key := strings.ToLower(c.Username)
+	if sessions[key] == nil {
+		sessions[key] = make(map[*models.Client]bool)
+	}
+	sessions[key][c] = true
+}
+
+// unregister removes c from the sessions of its user
+func unregister(c *models.Client) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	key := strings.ToLower(c.Username)
+	delete(sessions[key], c)
+	if len(sessions[key]) == 0 {
+		delete(sessions, key)
+	}
+}
+
+// ResolveMentions returns the users of the room addressed with @username in msg, in order of appearance
+func ResolveMentions(msg string, cr *models.ChatRoom) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(msg, -1) {
+		// Allow for sentences ending right after the username
+		name := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		c, ok := lookupClient(name, *cr)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		mentions = append(mentions, c.Username)
+	}
+	return mentions
+}
+
+// notifyMentions pushes a mention event to every connection of the users mentioned in evt, whichever room they are in
+func notifyMentions(evt *models.ChatEvent) {
+	for _, name := range evt.Mentions {
+		data := formatEventData(&models.ChatEvent{
+			EventType: models.Mention,
+			User:      evt.User,
+			RoomID:    evt.RoomID,
+			Msg:       evt.Msg,
+			Timestamp: evt.Timestamp,
+			ID:        NewEventID(),
+			TargetID:  evt.ID,
+		})
+		sessionsMu.Lock()
+		clients := make([]*models.Client, 0, len(sessions[strings.ToLower(name)]))
+		for c := range sessions[strings.ToLower(name)] {
+			clients = append(clients, c)
+		}
+		sessionsMu.Unlock()
+		// Queue straight to the outboxes rather than through the brokers of their rooms,
+		// a busy room must not hold up the sender
+		for _, c := range clients {
+			if !c.Outbox.Push(data) {
+				c.Outbox.CloseWith(websocket.CloseTryAgainLater, "outbound queue overflow")
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package features
+
+import (
+	"api_chat/models"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestResolveMentions(t *testing.T) {
+	cr := &models.ChatRoom{Clients: map[string]*models.Client{
+		"alice":     {Username: "Alice"},
+		"bob.smith": {Username: "bob.smith"},
+	}}
+	mentions := ResolveMentions("@alice, have you met @Bob.Smith? @carol @ALICE, @bob.smith.", cr)
+	if len(mentions) != 2 || mentions[0] != "Alice" || mentions[1] != "bob.smith" {
+		t.Errorf("Unexpected mentions %v", mentions)
+	}
+	if mentions := ResolveMentions("mail alice@example.com", cr); len(mentions) != 0 {
+		t.Errorf("Unexpected mentions %v", mentions)
+	}
+}
+
+func TestMentionNotification(t *testing.T) {
+	big := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	small := &models.ChatRoom{ID: 2, Broker: models.NewBroker(2), Clients: make(map[string]*models.Client)}
+	go big.Broker.Listen()
+	go small.Broker.Listen()
+	// Alice idles in the big room while chatting in the small one
+	idle := &models.Client{Username: "alice", Room: big, Outbox: models.NewOutbox(10, models.DropOldest)}
+	active := &models.Client{Username: "alice", Room: small, Outbox: models.NewOutbox(10, models.DropOldest)}
+	for _, c := range []*models.Client{idle, active} {
+		if err := AddClient(c, *c.Room); err != nil {
+			t.Fatal(err)
+		}
+		c.Room.Broker.OpenClient <- c
+	}
+	defer RemoveClient("alice", *big)
+	defer RemoveClient("alice", *small)
+
+	evt := &models.ChatEvent{User: "bob", RoomID: big.ID, ID: "question", Msg: "@alice can you help?", Mentions: ResolveMentions("@alice can you help?", big)}
+	notifyMentions(evt)
+	select {
+	case <-active.Outbox.Ready():
+		var mention models.ChatEvent
+		if err := json.Unmarshal(active.Outbox.Drain()[0], &mention); err != nil {
+			t.Fatal(err)
+		}
+		if mention.EventType != models.Mention || mention.TargetID != "question" || mention.RoomID != big.ID || mention.User != "bob" {
+			t.Errorf("Unexpected mention %+v", mention)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Mention was not delivered to the other room")
+	}
+}
+
+func TestMentionDoesNotBlock(t *testing.T) {
+	// The broker of the room Alice idles in is not listening
+	stalled := &models.ChatRoom{ID: 3, Broker: models.NewBroker(3), Clients: make(map[string]*models.Client)}
+	idle := &models.Client{Username: "alice", Room: stalled, Outbox: models.NewOutbox(1, models.Disconnect)}
+	if err := AddClient(idle, *stalled); err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveClient("alice", *stalled)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2; i++ {
+			notifyMentions(&models.ChatEvent{User: "bob", RoomID: 4, ID: NewEventID(), Msg: "@alice", Mentions: []string{"alice"}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Mentions blocked the sender")
+	}
+	if code, _ := idle.Outbox.CloseReason(); code != websocket.CloseTryAgainLater {
+		t.Errorf("Expected the overflowing client to be disconnected, got close code %d", code)
+	}
+}
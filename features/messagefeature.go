@@ -0,0 +1,97 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"strings"
+)
+
+// Edit changes the text of a stored message of its author and broadcasts the change to the room
+func Edit(evt *models.ChatEvent, author string, cr *models.ChatRoom) error {
+	if err := silenced(cr, author); err != nil {
+		return err
+	}
+	if err := authorize(evt.TargetID, author, cr); err != nil {
+		return err
+	}
+	stored, err := cr.Messages.Edit(cr.ID, evt.TargetID, evt.Msg, evt.Timestamp)
+	if err != nil {
+		return err
+	}
+	notifyChange(evt, stored, cr)
+	return nil
+}
+
+// Retract deletes a stored message of its author, leaving a tombstone, and broadcasts the change to the room.
+// Moderators may delete the messages of others.
+func Retract(evt *models.ChatEvent, author string, cr *models.ChatRoom) error {
+	if err := authorize(evt.TargetID, author, cr); err != nil && !Permitted(cr, author, ModerateMessages) {
+		return err
+	}
+	stored, err := cr.Messages.Delete(cr.ID, evt.TargetID, evt.Timestamp)
+	if err != nil {
+		return err
+	}
+	notifyChange(evt, stored, cr)
+	return nil
+}
+
+// React attaches an emoji of a user to a stored message and broadcasts the reaction to the room
+func React(evt *models.ChatEvent, user string, cr *models.ChatRoom) error {
+	if err := silenced(cr, user); err != nil {
+		return err
+	}
+	if err := cr.Messages.React(cr.ID, evt.TargetID, evt.Emoji, user); err != nil {
+		return err
+	}
+	notifyReaction(evt, user, cr)
+	return nil
+}
+
+// Unreact removes an emoji of a user from a stored message and broadcasts the removal to the room
+func Unreact(evt *models.ChatEvent, user string, cr *models.ChatRoom) error {
+	if err := cr.Messages.Unreact(cr.ID, evt.TargetID, evt.Emoji, user); err != nil {
+		return err
+	}
+	notifyReaction(evt, user, cr)
+	return nil
+}
+
+// authorize ensures only the original author changes a message
+func authorize(id string, author string, cr *models.ChatRoom) error {
+	stored, err := cr.Messages.Get(cr.ID, id)
+	if err != nil {
+		return err
+	}
+	if author == "" || !strings.EqualFold(stored.User, author) {
+		return &config.APIError{Code: 104, Field: "target_id"}
+	}
+	return nil
+}
+
+// notifyChange relays the new state of a stored message as a delta referencing it by TargetID
+func notifyChange(evt *models.ChatEvent, stored models.ChatEvent, cr *models.ChatRoom) {
+	evt.EventType = strings.ToLower(evt.EventType)
+	evt.RoomID = cr.ID
+	evt.User = stored.User
+	evt.Color = stored.Color
+	evt.Msg = stored.Msg
+	evt.EditedAt = stored.EditedAt
+	evt.Deleted = stored.Deleted
+	evt.Password = ""
+	cr.Broker.Notification <- formatEventData(evt)
+}
+
+// notifyReaction relays a reaction without the message it refers to, clients apply it to their copy
+func notifyReaction(evt *models.ChatEvent, user string, cr *models.ChatRoom) {
+	cr.Broker.Notification <- formatEventData(&models.ChatEvent{
+		EventType:   strings.ToLower(evt.EventType),
+		User:        user,
+		RoomID:      cr.ID,
+		Timestamp:   evt.Timestamp,
+		ID:          evt.ID,
+		ClientMsgID: evt.ClientMsgID,
+		TargetID:    evt.TargetID,
+		Emoji:       evt.Emoji,
+	})
+}
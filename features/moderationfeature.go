@@ -0,0 +1,118 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ranks orders the roles, users may only be sanctioned by users of a higher rank
+var ranks = map[string]int{
+	models.ReadOnly:  0,
+	models.Member:    1,
+	models.Moderator: 2,
+	models.Owner:     3,
+}
+
+// IsBanned reports whether a user is banned from a room
+func IsBanned(cr *models.ChatRoom, username string) bool {
+	return sanctioned(cr, models.Ban, username, time.Now())
+}
+
+// IsMuted reports whether a user may not send messages to a room
+func IsMuted(cr *models.ChatRoom, username string) bool {
+	return sanctioned(cr, models.Mute, username, time.Now())
+}
+
+// silenced refuses the messages, edits and reactions of banned and muted users
+func silenced(cr *models.ChatRoom, username string) error {
+	if IsBanned(cr, username) {
+		return &config.APIError{Code: 111, Field: "name"}
+	} else if IsMuted(cr, username) {
+		return &config.APIError{Code: 112, Field: "name"}
+	}
+	return nil
+}
+
+func sanctioned(cr *models.ChatRoom, kind string, username string, now time.Time) bool {
+	until, ok := cr.SanctionOf(kind, username)
+	return ok && (until.IsZero() || now.Before(until))
+}
+
+// CanModerate reports whether actor may kick, ban or mute target.
+// Moderators may sanction members and read-only users, owners anybody but themselves.
+func CanModerate(cr *models.ChatRoom, actor string, target string) bool {
+	if target == "" || strings.EqualFold(actor, target) || !Permitted(cr, actor, ModerateUsers) {
+		return false
+	}
+	return ranks[RoleOf(cr, actor)] > ranks[RoleOf(cr, target)]
+}
+
+// IsValidSanction validates a ban or mute. Sanctions without an end last until they are lifted.
+func IsValidSanction(kind string, until time.Time) error {
+	if kind != models.Ban && kind != models.Mute {
+		return &config.APIError{Code: 105, Field: "action"}
+	}
+	if !until.IsZero() && !until.After(time.Now()) {
+		return &config.APIError{Code: 105, Field: "duration"}
+	}
+	return nil
+}
+
+// Kick disconnects a user from a room, on whichever server instance they are connected to, with a close code
+// telling them why, and announces it to the others
+func Kick(cr *models.ChatRoom, target string) error {
+	if _, ok := reachable(target, *cr); !ok {
+		return &config.APIError{Code: 201, Field: "username"}
+	}
+	expel(cr, target, models.CloseKicked, "removed by a moderator")
+	announceSanction(cr, models.Kick, target, time.Time{}, fmt.Sprintf("%s was removed from the room.", target))
+	return nil
+}
+
+// Banish disconnects a banned user from a room and announces the ban
+func Banish(cr *models.ChatRoom, target string, until time.Time) {
+	expel(cr, target, models.CloseBanned, "banned from the room")
+	announceSanction(cr, models.Ban, target, until, fmt.Sprintf("%s was banned from the room.", target))
+}
+
+// Silence announces a user was muted
+func Silence(cr *models.ChatRoom, target string, until time.Time) {
+	announceSanction(cr, models.Mute, target, until, fmt.Sprintf("%s was muted.", target))
+}
+
+// Pardon announces a ban or mute was lifted
+func Pardon(cr *models.ChatRoom, kind string, target string) {
+	if kind == models.Ban {
+		announceSanction(cr, models.Unban, target, time.Time{}, fmt.Sprintf("%s is no longer banned.", target))
+	} else {
+		announceSanction(cr, models.Unmute, target, time.Time{}, fmt.Sprintf("%s is no longer muted.", target))
+	}
+}
+
+// expel removes a user from a room right away, rather than after the reconnection grace window, and closes their connection
+func expel(cr *models.ChatRoom, target string, code int, text string) {
+	if _, ok := lookupClient(target, *cr); ok {
+		if err := RemoveClient(target, *cr); err != nil {
+			config.Warning("error removing client", target, err.Error())
+		}
+	}
+	cr.Broker.DisconnectUsers(code, text, target)
+}
+
+func announceSanction(cr *models.ChatRoom, kind string, target string, until time.Time, msg string) {
+	evt := &models.ChatEvent{
+		EventType: kind,
+		User:      target,
+		RoomID:    cr.ID,
+		Msg:       msg,
+		ID:        NewEventID(),
+		Timestamp: time.Now(),
+	}
+	if !until.IsZero() {
+		evt.Until = &until
+	}
+	cr.Broker.Notification <- formatEventData(evt)
+}
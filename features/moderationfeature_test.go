@@ -0,0 +1,80 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"testing"
+	"time"
+)
+
+func TestCanModerate(t *testing.T) {
+	cr := &models.ChatRoom{Type: models.PrivateRoom, Owner: "alice",
+		Roles: map[string]string{"bob": models.Moderator, "erin": models.Moderator, "carol": models.ReadOnly}}
+	cases := []struct {
+		actor    string
+		target   string
+		expected bool
+	}{
+		{"alice", "bob", true},
+		{"alice", "dave", true},
+		{"alice", "alice", false},
+		{"bob", "carol", true},
+		{"bob", "dave", true},
+		{"bob", "erin", false},
+		{"bob", "Alice", false},
+		{"dave", "carol", false},
+		{"", "dave", false},
+		{"alice", "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.actor+" sanctions "+tc.target, func(t *testing.T) {
+			if allowed := CanModerate(cr, tc.actor, tc.target); allowed != tc.expected {
+				t.Errorf("Expected %t, got %t", tc.expected, allowed)
+			}
+		})
+	}
+}
+
+func TestSanctioned(t *testing.T) {
+	now := time.Now()
+	cr := &models.ChatRoom{Banned: map[string]time.Time{"alice": {}, "bob": now.Add(time.Minute), "carol": now.Add(-time.Minute)}}
+	cases := []struct {
+		username string
+		expected bool
+	}{
+		{"Alice", true},
+		{"bob", true},
+		{"carol", false},
+		{"dave", false},
+	}
+	for _, tc := range cases {
+		if s := sanctioned(cr, models.Ban, tc.username, now); s != tc.expected {
+			t.Errorf("Expected %s sanctioned %t, got %t", tc.username, tc.expected, s)
+		}
+	}
+}
+
+func TestMutedUsers(t *testing.T) {
+	// The stores of the room must not be reached
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client),
+		Messages: failingMessages{}, Muted: map[string]time.Time{"mallory": {}}}
+	c := &models.Client{Username: "Mallory", Room: cr}
+	cr.Clients["mallory"] = c
+	cr.Clients["bob"] = &models.Client{Username: "bob", Room: cr}
+	cases := []struct {
+		name   string
+		action func() error
+	}{
+		{"send", func() error { return Send(&models.ChatEvent{User: "Mallory", Msg: "hi"}, cr) }},
+		{"edit", func() error { return Edit(&models.ChatEvent{TargetID: "01M", Msg: "hi"}, "Mallory", cr) }},
+		{"react", func() error { return React(&models.ChatEvent{TargetID: "01M", Emoji: "👍"}, "Mallory", cr) }},
+		{"direct message", func() error { return SendDirect(&models.ChatEvent{Msg: "hi", Recipients: []string{"bob"}}, c) }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err, ok := tc.action().(*config.APIError); !ok || err.Code != 112 {
+				t.Errorf("Expected muted user to be refused, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package features
+
+import (
+	"api_chat/models"
+	"time"
+)
+
+var (
+	// PresenceInterval is how often the presence of connected clients is re-evaluated
+	PresenceInterval = 15 * time.Second
+	// IdleAfter is how long a client may be inactive before it is idle
+	IdleAfter = 2 * time.Minute
+	// AwayAfter is how long a client may be inactive before it is away
+	AwayAfter = 10 * time.Minute
+)
+
+// Presence derives the presence of c at now from its last activity and the last time its connection answered a ping
+func Presence(c *models.Client, now time.Time) string {
+	lastActivity, lastPong := c.Activity()
+	if !lastPong.IsZero() && now.Sub(lastPong) > models.PongWait {
+		return models.Offline
+	}
+	switch inactive := now.Sub(lastActivity); {
+	case inactive >= AwayAfter:
+		return models.Away
+	case inactive >= IdleAfter:
+		return models.Idle
+	default:
+		return models.Online
+	}
+}
+
+// watchPresence re-evaluates the presence of c every PresenceInterval until done is closed
+func watchPresence(c *models.Client, done <-chan struct{}) {
+	ticker := time.NewTicker(PresenceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			updatePresence(c)
+		case <-done:
+			return
+		}
+	}
+}
+
+// updatePresence announces the presence of a client that joined its room, if it changed
+func updatePresence(c *models.Client) {
+	if c.Username == "" || !isMember(c) {
+		return
+	}
+	setPresence(c, Presence(c, time.Now()))
+}
+
+// setPresence records state as the presence of c and broadcasts the transition.
+// Clients that disconnect are announced by their departure instead.
+func setPresence(c *models.Client, state string) {
+	previous := c.SwapPresence(state)
+	// Joining the room already tells others the user is online, leaving it that they are offline
+	if previous == state || previous == "" {
+		return
+	}
+	c.Room.Broker.Notification <- formatEventData(&models.ChatEvent{
+		EventType: models.PresenceChange,
+		User:      c.Username,
+		Color:     c.Color,
+		RoomID:    c.Room.ID,
+		Timestamp: time.Now(),
+		ID:        NewEventID(),
+		Presence:  state,
+	})
+}
@@ -0,0 +1,115 @@
+package features
+
+import (
+	"api_chat/models"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name         string
+		lastActivity time.Time
+		lastPong     time.Time
+		expected     string
+	}{
+		{"active", now, now, models.Online},
+		{"never pinged", now, time.Time{}, models.Online},
+		{"inactive", now.Add(-IdleAfter), now, models.Idle},
+		{"long inactive", now.Add(-AwayAfter), now, models.Away},
+		{"unresponsive", now, now.Add(-2 * models.PongWait), models.Offline},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &models.Client{LastActivity: tc.lastActivity, LastPong: tc.lastPong}
+			if presence := Presence(c, now); presence != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, presence)
+			}
+		})
+	}
+}
+
+func TestPresenceTransitions(t *testing.T) {
+	IdleAfter = 20 * time.Millisecond
+	AwayAfter = time.Hour
+	PresenceInterval = 5 * time.Millisecond
+	defer func() { IdleAfter, AwayAfter, PresenceInterval = 2*time.Minute, 10*time.Minute, 15*time.Second }()
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	go cr.Broker.Listen()
+	observer := &models.Client{Username: "observer", Room: cr, Outbox: models.NewOutbox(10, models.DropOldest)}
+	cr.Broker.OpenClient <- observer
+	alice := &models.Client{Username: "alice", Room: cr, LastActivity: time.Now(), Presence: models.Online}
+	if err := AddClient(alice, *cr); err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveClient("alice", *cr)
+	done := make(chan struct{})
+	defer close(done)
+	go watchPresence(alice, done)
+	select {
+	case <-observer.Outbox.Ready():
+		var evt models.ChatEvent
+		if err := json.Unmarshal(observer.Outbox.Drain()[0], &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.EventType != models.PresenceChange || evt.User != "alice" || evt.Presence != models.Idle {
+			t.Errorf("Unexpected event %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Idle transition was not announced")
+	}
+	var users struct {
+		Users []models.Client `json:"users"`
+	}
+	data, _ := ToJSON(*cr)
+	if err := json.Unmarshal(data, &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Users) != 1 || users.Users[0].Presence != models.Idle {
+		t.Errorf("Unexpected users %+v", users.Users)
+	}
+}
+
+func TestPresenceAnnouncedOnce(t *testing.T) {
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	alice := &models.Client{Username: "alice", Room: cr, Presence: models.Online}
+	// The presence watcher and the read pump may both notice a transition
+	for i := 0; i < 2; i++ {
+		go setPresence(alice, models.Idle)
+	}
+	<-cr.Broker.Notification
+	select {
+	case <-cr.Broker.Notification:
+		t.Error("Presence transition was announced twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPresenceWhileActive(t *testing.T) {
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	alice := &models.Client{Username: "alice", Room: cr, LastActivity: time.Now(), Presence: models.Online}
+	if err := AddClient(alice, *cr); err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveClient("alice", *cr)
+	// The read pump records activity while the watcher and requests look at it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			alice.Touch(time.Now())
+			alice.Ponged(time.Now())
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if presence := Presence(alice, time.Now()); presence != models.Online {
+			t.Fatalf("Expected active client to be online, got %s", presence)
+		}
+		if _, err := ToJSON(*cr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,31 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+)
+
+// Acknowledge records that c read the messages of its room up to evt.ReadSeq and
+// tells the room, along with the number of messages c has left unread
+func Acknowledge(evt *models.ChatEvent, c *models.Client) error {
+	if c.Username == "" {
+		return &config.APIError{Code: 204, Field: "name"}
+	}
+	if err := c.Room.Messages.MarkRead(c.Room.ID, c.Username, evt.ReadSeq); err != nil {
+		return err
+	}
+	lastRead, unread, err := c.Room.Messages.Unread(c.Room.ID, c.Username)
+	if err != nil {
+		return err
+	}
+	c.Room.Broker.Notification <- formatEventData(&models.ChatEvent{
+		EventType: models.Receipt,
+		User:      c.Username,
+		RoomID:    c.Room.ID,
+		Timestamp: evt.Timestamp,
+		ID:        evt.ID,
+		ReadSeq:   lastRead,
+		Unread:    unread,
+	})
+	return nil
+}
@@ -0,0 +1,70 @@
+package features
+
+import (
+	"api_chat/models"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReconnectGrace is how long the departure of a disconnected client is held back.
+// A user reconnecting within it neither leaves nor re-enters the room in the eyes of the others.
+var ReconnectGrace = 10 * time.Second
+
+type departure struct {
+	roomID int
+	user   string
+}
+
+var (
+	departures   = make(map[departure]*time.Timer)
+	departuresMu sync.Mutex
+)
+
+// depart removes a disconnected client from its room and announces it once the grace window has passed
+func depart(c *models.Client) {
+	if err := RemoveClient(c.Username, *c.Room); err != nil {
+		log.Println("Error removing client", err.Error())
+	}
+	evt := &models.ChatEvent{
+		EventType: models.Unsubscribe,
+		User:      c.Username,
+		Color:     c.Color,
+		RoomID:    c.Room.ID,
+		Msg:       fmt.Sprintf("%s has left the room.", c.Username),
+	}
+	key := departure{roomID: c.Room.ID, user: strings.ToLower(c.Username)}
+	departuresMu.Lock()
+	defer departuresMu.Unlock()
+	if t, ok := departures[key]; ok {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(ReconnectGrace, func() {
+		departuresMu.Lock()
+		if departures[key] == t {
+			delete(departures, key)
+		}
+		departuresMu.Unlock()
+		evt.ID = NewEventID()
+		evt.Timestamp = time.Now()
+		c.Room.Broker.Notification <- formatEventData(evt)
+	})
+	departures[key] = t
+}
+
+// returning reports whether a joining client reconnects within the grace window of its departure,
+// in which case the pending departure is cancelled
+func returning(c *models.Client) bool {
+	key := departure{roomID: c.Room.ID, user: strings.ToLower(c.Username)}
+	departuresMu.Lock()
+	defer departuresMu.Unlock()
+	t, ok := departures[key]
+	if !ok {
+		return false
+	}
+	delete(departures, key)
+	return t.Stop()
+}
@@ -0,0 +1,83 @@
+package features
+
+import (
+	"api_chat/models"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReconnectGrace(t *testing.T) {
+	ReconnectGrace = 50 * time.Millisecond
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	go cr.Broker.Listen()
+	observer := &models.Client{Username: "observer", Room: cr, Outbox: models.NewOutbox(10, models.DropOldest)}
+	cr.Broker.OpenClient <- observer
+
+	alice := &models.Client{Username: "Alice", Room: cr}
+	if err := AddClient(alice, *cr); err != nil {
+		t.Fatal(err)
+	}
+	// Reconnecting within the grace window goes unnoticed
+	depart(alice)
+	if _, ok := cr.Clients["alice"]; ok {
+		t.Error("Disconnected client is still listed")
+	}
+	if !returning(&models.Client{Username: "alice", Room: cr}) {
+		t.Error("Expected client to be returning")
+	}
+	select {
+	case <-observer.Outbox.Ready():
+		t.Errorf("Unexpected event %s", observer.Outbox.Drain())
+	case <-time.After(2 * ReconnectGrace):
+	}
+
+	// Staying away announces the departure
+	depart(alice)
+	select {
+	case <-observer.Outbox.Ready():
+		var evt models.ChatEvent
+		if err := json.Unmarshal(observer.Outbox.Drain()[0], &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.EventType != models.Unsubscribe || evt.User != "Alice" {
+			t.Errorf("Unexpected event %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Departure was not announced")
+	}
+	if returning(alice) {
+		t.Error("Client returning after the grace window should be announced")
+	}
+}
+
+func TestClientsConcurrentAccess(t *testing.T) {
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		c := &models.Client{Username: fmt.Sprintf("user%d", i), Room: cr}
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 100; j++ {
+				if err := AddClient(c, *cr); err != nil {
+					t.Error(err)
+					return
+				}
+				if !isMember(c) {
+					t.Error("Expected client to be a member")
+				}
+				if err := RemoveClient(c.Username, *cr); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+	if len(cr.Clients) != 0 {
+		t.Errorf("Expected no clients left, got %d", len(cr.Clients))
+	}
+}
@@ -0,0 +1,86 @@
+package features
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"strings"
+)
+
+// Actions on a room besides the event types of models, which are actions too
+const (
+	// ReadRoom covers fetching a room, its history and attachments, and following its events
+	ReadRoom = "read"
+	// UpdateRoom covers changing the title, description and visibility of a room
+	UpdateRoom = "update"
+	// DeleteRoom covers deleting a room along with its history
+	DeleteRoom = "remove"
+	// ChangePassword covers changing the password of a room, which disconnects all of its users.
+	// Unlike the other changes to a room, only owners may do it, so it is never granted in rooms without one.
+	ChangePassword = "password"
+	// ManageRoles covers granting roles to the users of a room
+	ManageRoles = "roles"
+	// ModerateMessages covers deleting the messages of others
+	ModerateMessages = "moderate"
+	// ModerateUsers covers kicking, banning and muting users
+	ModerateUsers = "sanction"
+)
+
+// permissions is the permission matrix: the actions each role may perform
+var permissions = map[string][]string{
+	models.ReadOnly: {ReadRoom, models.Subscribe, models.Unsubscribe, models.Receipt},
+	models.Member: {ReadRoom, models.Subscribe, models.Unsubscribe, models.Receipt,
+		models.Broadcast, models.Edit, models.Delete, models.React, models.Unreact, models.DirectMessage, models.Typing},
+	models.Moderator: {ReadRoom, models.Subscribe, models.Unsubscribe, models.Receipt,
+		models.Broadcast, models.Edit, models.Delete, models.React, models.Unreact, models.DirectMessage, models.Typing,
+		ModerateMessages, ModerateUsers},
+	models.Owner: {ReadRoom, models.Subscribe, models.Unsubscribe, models.Receipt,
+		models.Broadcast, models.Edit, models.Delete, models.React, models.Unreact, models.DirectMessage, models.Typing,
+		ModerateMessages, ModerateUsers, UpdateRoom, DeleteRoom, ChangePassword, ManageRoles},
+}
+
+// Allowed reports whether a role permits an action
+func Allowed(role string, action string) bool {
+	for _, permitted := range permissions[role] {
+		if permitted == action {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleOf returns the role of a user in a room. Anonymous users and users without a granted role are members.
+func RoleOf(cr *models.ChatRoom, username string) string {
+	if username == "" {
+		return models.Member
+	}
+	if cr.Owner != "" && strings.EqualFold(cr.Owner, username) {
+		return models.Owner
+	}
+	if role, ok := cr.GrantedRole(username); ok {
+		return role
+	}
+	return models.Member
+}
+
+// Permitted reports whether a user may perform an action in a room.
+// Rooms created anonymously have no owner: as before ownership existed, anybody authorized for them may change or delete them.
+func Permitted(cr *models.ChatRoom, username string, action string) bool {
+	if cr.Owner == "" && (action == UpdateRoom || action == DeleteRoom) {
+		return true
+	}
+	return Allowed(RoleOf(cr, username), action)
+}
+
+// IsValidRole validates a role granted to a registered user of a room. Ownership can neither be granted nor revoked.
+func IsValidRole(cr *models.ChatRoom, username string, role string) error {
+	if role != models.Moderator && role != models.Member && role != models.ReadOnly {
+		return &config.APIError{Code: 105, Field: "role"}
+	}
+	if !IsRegistered(username) {
+		return &config.APIError{Code: 201, Field: "username"}
+	}
+	if strings.EqualFold(cr.Owner, username) {
+		return &config.APIError{Code: 104, Field: "username"}
+	}
+	return nil
+}
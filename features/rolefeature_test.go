@@ -0,0 +1,45 @@
+package features
+
+import (
+	"api_chat/models"
+	"testing"
+)
+
+func TestPermitted(t *testing.T) {
+	owned := &models.ChatRoom{Type: models.PrivateRoom, Owner: "Alice",
+		Roles: map[string]string{"bob": models.Moderator, "carol": models.ReadOnly}}
+	ownerless := &models.ChatRoom{Type: models.PrivateRoom}
+	cases := []struct {
+		name     string
+		cr       *models.ChatRoom
+		username string
+		action   string
+		expected bool
+	}{
+		{"owner deletes room", owned, "alice", DeleteRoom, true},
+		{"owner grants roles", owned, "ALICE", ManageRoles, true},
+		{"moderator deletes room", owned, "Bob", DeleteRoom, false},
+		{"moderator deletes messages", owned, "bob", ModerateMessages, true},
+		{"member sends", owned, "dave", models.Broadcast, true},
+		{"member updates room", owned, "dave", UpdateRoom, false},
+		{"member deletes messages", owned, "dave", ModerateMessages, false},
+		{"anonymous reads", owned, "", ReadRoom, true},
+		{"read-only joins", owned, "carol", models.Subscribe, true},
+		{"read-only reads", owned, "carol", ReadRoom, true},
+		{"read-only sends", owned, "carol", models.Broadcast, false},
+		{"read-only reacts", owned, "carol", models.React, false},
+		{"unknown action", owned, "alice", "fly", false},
+		{"anybody updates ownerless room", ownerless, "dave", UpdateRoom, true},
+		{"nobody moderates ownerless room", ownerless, "dave", ModerateMessages, false},
+		{"owner changes password", owned, "alice", ChangePassword, true},
+		{"moderator changes password", owned, "bob", ChangePassword, false},
+		{"nobody changes password of ownerless room", ownerless, "dave", ChangePassword, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if permitted := Permitted(tc.cr, tc.username, tc.action); permitted != tc.expected {
+				t.Errorf("Expected %t, got %t", tc.expected, permitted)
+			}
+		})
+	}
+}
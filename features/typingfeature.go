@@ -0,0 +1,90 @@
+package features
+
+import (
+	"api_chat/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// TypingThrottle is the minimum interval between two typing events of a user being relayed
+	TypingThrottle = 2 * time.Second
+	// TypingTimeout is how long a user is shown typing after their last typing event
+	TypingTimeout = 5 * time.Second
+)
+
+type typingKey struct {
+	roomID int
+	user   string
+}
+
+type typist struct {
+	relayed time.Time
+	expiry  *time.Timer
+}
+
+var (
+	typists   = make(map[typingKey]*typist)
+	typistsMu sync.Mutex
+)
+
+// startTyping relays that c is composing a message to the other clients of its room, at most once per TypingThrottle.
+// The indicator expires after TypingTimeout without further typing events.
+func startTyping(c *models.Client) {
+	if c.Username == "" {
+		return
+	}
+	key := typingKey{roomID: c.Room.ID, user: strings.ToLower(c.Username)}
+	typistsMu.Lock()
+	t, ok := typists[key]
+	if !ok {
+		t = &typist{}
+		typists[key] = t
+	} else {
+		t.expiry.Stop()
+	}
+	var expiry *time.Timer
+	expiry = time.AfterFunc(TypingTimeout, func() {
+		typistsMu.Lock()
+		expired := typists[key] == t && t.expiry == expiry
+		if expired {
+			delete(typists, key)
+		}
+		typistsMu.Unlock()
+		if expired {
+			c.Room.Broker.SendExcept(typingEvent(models.StoppedTyping, c), c)
+		}
+	})
+	t.expiry = expiry
+	relay := time.Since(t.relayed) >= TypingThrottle
+	if relay {
+		t.relayed = time.Now()
+	}
+	typistsMu.Unlock()
+	if relay {
+		c.Room.Broker.SendExcept(typingEvent(models.Typing, c), c)
+	}
+}
+
+// stopTyping clears the indicator of c once it sent its message. Other clients take the message as the end of typing.
+func stopTyping(c *models.Client) {
+	key := typingKey{roomID: c.Room.ID, user: strings.ToLower(c.Username)}
+	typistsMu.Lock()
+	defer typistsMu.Unlock()
+	if t, ok := typists[key]; ok {
+		t.expiry.Stop()
+		delete(typists, key)
+	}
+}
+
+func typingEvent(eventType string, c *models.Client) []byte {
+	return formatEventData(&models.ChatEvent{
+		EventType: eventType,
+		User:      c.Username,
+		Color:     c.Color,
+		RoomID:    c.Room.ID,
+		ID:        NewEventID(),
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,52 @@
+package features
+
+import (
+	"api_chat/models"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTyping(t *testing.T) {
+	TypingThrottle = time.Hour
+	TypingTimeout = 50 * time.Millisecond
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client)}
+	go cr.Broker.Listen()
+	alice := &models.Client{Username: "alice", Room: cr, Outbox: models.NewOutbox(10, models.DropOldest)}
+	bob := &models.Client{Username: "bob", Room: cr, Outbox: models.NewOutbox(10, models.DropOldest)}
+	cr.Broker.OpenClient <- alice
+	cr.Broker.OpenClient <- bob
+
+	// Repeated typing events within the throttle interval are relayed once
+	for i := 0; i < 3; i++ {
+		startTyping(alice)
+	}
+	var events []models.ChatEvent
+	deadline := time.After(time.Second)
+	for len(events) < 2 {
+		select {
+		case <-bob.Outbox.Ready():
+			for _, data := range bob.Outbox.Drain() {
+				var evt models.ChatEvent
+				if err := json.Unmarshal(data, &evt); err != nil {
+					t.Fatal(err)
+				}
+				events = append(events, evt)
+			}
+		case <-deadline:
+			t.Fatalf("Expected typing and its expiry, got %+v", events)
+		}
+	}
+	if len(events) != 2 || events[0].EventType != models.Typing || events[1].EventType != models.StoppedTyping || events[1].User != "alice" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+	// Like every other event, typing events can be told apart by their ID
+	if events[0].ID == "" || events[1].ID == "" || events[0].ID == events[1].ID {
+		t.Errorf("Expected typing events to carry distinct IDs, got %+v", events)
+	}
+	select {
+	case <-alice.Outbox.Ready():
+		t.Errorf("Typing events were echoed to the sender: %q", alice.Outbox.Drain())
+	default:
+	}
+}
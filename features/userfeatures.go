@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/websocket"
-	"io"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -16,7 +16,9 @@ import (
 // ensures that there is at most one reader on a connection by executing all
 // reads from this goroutine.
 func ReadPump(c *models.Client) {
+	done := make(chan struct{})
 	defer func() {
+		close(done)
 		c.Room.Broker.CloseClient <- c
 		err := c.Conn.Close()
 		if err != nil {
@@ -27,53 +29,108 @@ func ReadPump(c *models.Client) {
 	if err := c.Conn.SetReadDeadline(time.Now().Add(models.PongWait)); err != nil {
 		log.Println("Error setting pongWait read deadline", err.Error())
 	}
+	c.Ponged(time.Now())
 	c.Conn.SetPongHandler(func(string) error {
+		c.Ponged(time.Now())
 		if err := c.Conn.SetReadDeadline(time.Now().Add(models.PongWait)); err != nil {
 			log.Println("Error setting pongWait read deadline", err.Error())
 		}
 		return nil
 	})
+	// The presence watcher starts once the client joined, its name and color no longer change by then
+	watching := false
 	for {
 		mt, data, err := c.Conn.ReadMessage() // TODO: Switch to ReadJSON
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) || err == io.EOF {
-				res, _ := json.Marshal(&models.ChatEvent{User: c.Username, Msg: fmt.Sprintf("%s has left the room.", c.Username), Color: c.Color})
-				c.Room.Broker.Notification <- res
+			// Clients that did not leave explicitly may be reconnecting
+			if c.Username != "" && isMember(c) {
+				depart(c)
 			}
-			unsubscribe(&models.ChatEvent{User: c.Username, Color: c.Color}, c)
 			log.Printf("error: %v", err)
 			break
 		}
 		switch mt {
 		case websocket.TextMessage:
-			ce, err := ValidateEvent(data)
+			ce, err := ValidateEventAs(data, c.Identity)
 			if err != nil {
 				log.Printf("Error parsing JSON ChatEvent: %v", err)
 				break
 			}
-			// Set timestamp and room ID
+			// Set ID, timestamp and room ID
+			ce.ID = NewEventID()
 			ce.Timestamp = time.Now()
 			ce.RoomID = c.Room.ID
+			// Once joined, clients act under the name they joined with whatever the event says
+			if ce.EventType != models.Subscribe && c.Username != "" {
+				ce.User = c.Username
+			}
+			if !Permitted(c.Room, ce.User, ce.EventType) {
+				log.Printf("Warning: %s may not %s in room %d", ce.User, ce.EventType, c.Room.ID)
+				break
+			}
 
 			// Perform requested action
 			switch ce.EventType {
 			case models.Unsubscribe:
 				// Populate activity
-				c.Room.Clients[ce.User].LastActivity = ce.Timestamp
+				c.Touch(ce.Timestamp)
 				unsubscribe(&ce, c)
 			case models.Subscribe:
 				// LastActivity will be populated in subscribe
 				subscribe(&ce, c)
+				if !watching && isMember(c) {
+					watching = true
+					go watchPresence(c, done)
+				}
 			case models.Broadcast:
 				// Populate activity
-				c.Room.Clients[ce.User].LastActivity = ce.Timestamp
+				c.Touch(ce.Timestamp)
 				broadcast(&ce, c)
+			case models.Edit:
+				// Populate activity
+				c.Touch(ce.Timestamp)
+				if err := Edit(&ce, c.Username, c.Room); err != nil {
+					log.Println("Error editing message:", err.Error())
+				}
+			case models.Delete:
+				// Populate activity
+				c.Touch(ce.Timestamp)
+				if err := Retract(&ce, c.Username, c.Room); err != nil {
+					log.Println("Error deleting message:", err.Error())
+				}
+			case models.React:
+				// Populate activity
+				c.Touch(ce.Timestamp)
+				if err := React(&ce, c.Username, c.Room); err != nil {
+					log.Println("Error adding reaction:", err.Error())
+				}
+			case models.Unreact:
+				// Populate activity
+				c.Touch(ce.Timestamp)
+				if err := Unreact(&ce, c.Username, c.Room); err != nil {
+					log.Println("Error removing reaction:", err.Error())
+				}
+			case models.Typing:
+				// Typing is not an activity and is never stored
+				startTyping(c)
+			case models.Receipt:
+				if err := Acknowledge(&ce, c); err != nil {
+					log.Println("Error storing receipt:", err.Error())
+				}
+			case models.DirectMessage:
+				// Populate activity
+				c.Touch(ce.Timestamp)
+				if err := SendDirect(&ce, c); err != nil {
+					log.Println("Error sending direct message:", err.Error())
+				}
 			default:
 				// Populate activity
-				//c.Room.Clients[ce.User].LastActivity = ce.Timestamp
+				//c.LastActivity = ce.Timestamp
 				//broadcast(&ce,c)
 				log.Printf("Warning: unknown event type %s", ce.EventType)
 			}
+			// Activity brings idle and away users back online right away
+			updatePresence(c)
 
 		default:
 			log.Printf("Warning: unknown message type")
@@ -97,37 +154,26 @@ func WritePump(c *models.Client) {
 	}()
 	for {
 		select {
-		case message, ok := <-c.Send:
-			if err := c.Conn.SetWriteDeadline(time.Now().Add(models.WriteWait)); err != nil {
-				log.Println("Error setting writeWait write deadline", err.Error())
-			}
-			if !ok {
-				// The broker closed the channel.
-				if err := c.Conn.WriteMessage(websocket.CloseMessage, []byte{}); err != nil {
-					log.Println("Error writing WebSocket closing message:", err.Error())
+		case <-c.Outbox.Ready():
+			// Every event is written as its own message so clients can parse them individually
+			for _, message := range c.Outbox.Drain() {
+				if err := c.Conn.SetWriteDeadline(time.Now().Add(models.WriteWait)); err != nil {
+					log.Println("Error setting writeWait write deadline", err.Error())
 				}
-				return
-			}
-
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			if _, err := w.Write(message); err != nil {
-				log.Printf("Error writing message. Error: %s", err.Error())
-			}
-
-			// Add queued chat messages to the current websocket message.
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				if _, err := w.Write(<-c.Send); err != nil {
-					log.Printf("Error writing sent message. Error: %s", err.Error())
+				if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					log.Printf("Error writing message. Error: %s", err.Error())
+					return
 				}
 			}
-
-			if err := w.Close(); err != nil {
-				return
+		case <-c.Outbox.Done():
+			// The broker closed the queue.
+			if err := c.Conn.SetWriteDeadline(time.Now().Add(models.WriteWait)); err != nil {
+				log.Println("Error setting writeWait write deadline", err.Error())
+			}
+			if err := c.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.Outbox.CloseReason())); err != nil {
+				log.Println("Error writing WebSocket closing message:", err.Error())
 			}
+			return
 		case <-ticker.C:
 			if err := c.Conn.SetWriteDeadline(time.Now().Add(models.WriteWait)); err != nil {
 				log.Println("Error setting writeWait write deadline", err.Error())
@@ -139,26 +185,111 @@ func WritePump(c *models.Client) {
 	}
 }
 
+// ReplayCount is the number of stored messages a client receives when joining a room
+var ReplayCount = 50
+
 func formatEventData(c *models.ChatEvent) []byte {
 	data, _ := json.Marshal(c)
 	return data
 }
 
 func broadcast(evt *models.ChatEvent, c *models.Client) {
+	stopTyping(c)
+	if err := Send(evt, c.Room); err != nil {
+		log.Println("Error storing message:", err.Error())
+	}
+}
+
+// Send stores a message in the history of a room and broadcasts it to all its clients
+func Send(evt *models.ChatEvent, cr *models.ChatRoom) (err error) {
 	evt.EventType = models.Broadcast
-	c.Room.Broker.Notification <- formatEventData(evt)
+	evt.RoomID = cr.ID
+	// Never store or relay the room password
+	evt.Password = ""
+	if err = silenced(cr, evt.User); err != nil {
+		return
+	}
+	if evt.ParentID != "" {
+		var parent models.ChatEvent
+		if parent, err = cr.Messages.Get(cr.ID, evt.ParentID); err != nil {
+			return
+		}
+		// Threads are one level deep, replies to replies join the thread of their parent
+		if parent.ParentID != "" {
+			evt.ParentID = parent.ParentID
+		}
+	}
+	if err = checkAttachments(evt, cr); err != nil {
+		return
+	}
+	evt.Mentions = ResolveMentions(evt.Msg, cr)
+	if err = cr.Messages.Append(evt); err != nil {
+		return
+	}
+	cr.Broker.Notification <- formatEventData(evt)
+	notifyMentions(evt)
+	return
+}
+
+// Replay sends stored messages of the room to a client that just joined, ahead of live traffic.
+// Resuming clients receive the messages they missed, others the latest ReplayCount messages.
+// Both are followed by the latest direct messages of the client.
+func Replay(c *models.Client) {
+	var history []models.ChatEvent
+	var err error
+	if c.LastSeq > 0 {
+		history, err = c.Room.Messages.Since(c.Room.ID, c.LastSeq, models.QueueSize)
+	} else if ReplayCount > 0 {
+		history, err = c.Room.Messages.Recent(c.Room.ID, ReplayCount)
+	}
+	if err != nil {
+		log.Println("Error loading history:", err.Error())
+		return
+	}
+	// Direct messages are not sequenced, clients drop the ones they already have by ID
+	if c.Username != "" && ReplayCount > 0 {
+		var direct []models.ChatEvent
+		if direct, err = c.Room.Conversations.Recent(c.Room.ID, c.Username, ReplayCount); err != nil {
+			log.Println("Error loading direct messages:", err.Error())
+		}
+		history = append(history, direct...)
+	}
+	for i := range history {
+		c.Room.Broker.Direct <- models.Envelope{
+			Data:  formatEventData(&history[i]),
+			Match: func(recipient *models.Client) bool { return recipient == c },
+		}
+	}
 }
 
 func subscribe(evt *models.ChatEvent, c *models.Client) {
+	if IsBanned(c.Room, evt.User) || (c.Identity != "" && IsBanned(c.Room, c.Identity)) {
+		log.Println("Refusing banned client: ", evt.User)
+		c.Outbox.CloseWith(models.CloseBanned, "banned from the room")
+		return
+	}
+	// A connection belongs to a single user, who may leave and join again
+	if c.Username != "" && !strings.EqualFold(c.Username, evt.User) {
+		log.Println("Refusing to rename client", c.Username, "to", evt.User)
+		return
+	}
 	// Init client values
-	c.Username = evt.User
-	c.Color = evt.Color
-	c.LastActivity = time.Now()
+	if c.Username == "" {
+		c.Username = evt.User
+		c.Color = evt.Color
+	}
+	c.Touch(time.Now())
+	c.SwapPresence(models.Online)
 	if err := AddClient(c, *c.Room); err != nil {
 		log.Println("error adding client:", err.Error())
 		return
 	}
 	log.Println("Adding client to Chatroom: ", evt.User)
+	Replay(c)
+	if returning(c) {
+		log.Println("Client reconnected to Chatroom: ", evt.User)
+		return
+	}
 	evt.EventType = models.Subscribe
 	evt.Msg = fmt.Sprintf("%s entered the room.", evt.User)
 	go func() {
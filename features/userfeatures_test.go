@@ -0,0 +1,102 @@
+package features
+
+import (
+	"api_chat/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// failingMessages is a MessageStore refusing to store anything
+type failingMessages struct {
+	models.MessageStore
+}
+
+func (failingMessages) Append(*models.ChatEvent) error {
+	return errors.New("disk full")
+}
+
+func TestSendFailure(t *testing.T) {
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client), Messages: failingMessages{}}
+	result := make(chan error, 1)
+	go func() {
+		result <- Send(&models.ChatEvent{User: "alice", Msg: "hi", ID: NewEventID(), Timestamp: time.Now()}, cr)
+	}()
+	select {
+	case <-cr.Broker.Notification:
+		t.Fatal("Message that was not stored was broadcast")
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected the storage error to be returned")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return")
+	}
+}
+
+// recordingMessages is a MessageStore keeping the events appended to it
+type recordingMessages struct {
+	models.MessageStore
+	appended chan models.ChatEvent
+}
+
+func (m recordingMessages) Append(evt *models.ChatEvent) error {
+	m.appended <- *evt
+	return nil
+}
+
+func TestSendAsJoinedUser(t *testing.T) {
+	ReplayCount = 0
+	defer func() { ReplayCount = 50 }()
+	messages := recordingMessages{appended: make(chan models.ChatEvent, 10)}
+	cr := &models.ChatRoom{ID: 1, Broker: models.NewBroker(1), Clients: make(map[string]*models.Client),
+		Messages: messages, Muted: map[string]time.Time{"mallory": {}}}
+	go cr.Broker.Listen()
+	upgrader := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := models.NewClient(cr, conn)
+		cr.Broker.OpenClient <- c
+		go WritePump(c)
+		ReadPump(c)
+	}))
+	defer s.Close()
+	for _, name := range []string{"mallory", "trent"} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		// Both claim to be bob once joined
+		for _, evt := range []string{
+			fmt.Sprintf(`{"event_type":"join","name":"%s"}`, name),
+			fmt.Sprintf(`{"event_type":"send","name":"bob","msg":"hi from %s"}`, name),
+		} {
+			if err = conn.WriteMessage(websocket.TextMessage, []byte(evt)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	select {
+	case evt := <-messages.appended:
+		if evt.User != "trent" || evt.Msg != "hi from trent" {
+			t.Errorf("Expected the message of trent only, got %+v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Message was not stored")
+	}
+	select {
+	case evt := <-messages.appended:
+		t.Errorf("Muted user sent %+v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"api_chat/repository"
+)
+
+// API bundles the HTTP handlers together with the stores they operate on
+type API struct {
+	Rooms    repository.RoomStore
+	Accounts repository.AccountStore
+}
+
+// NewAPI returns an API serving chat rooms and user accounts from the given stores
+func NewAPI(rooms repository.RoomStore, accounts repository.AccountStore) *API {
+	return &API{Rooms: rooms, Accounts: accounts}
+}
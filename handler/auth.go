@@ -4,7 +4,7 @@ import (
 	"api_chat/config"
 	"api_chat/features"
 	"api_chat/models"
-	"api_chat/repository"
+	"context"
 	"encoding/json"
 	"net/http"
 	"reflect"
@@ -20,7 +20,7 @@ var SecretKey string = "my_secret_random_key_>_than_24_characters"
 
 // Add authorization
 // POST /chats/{titleOrID}/token
-func Login(w http.ResponseWriter, r *http.Request) (err error) {
+func (api *API) Login(w http.ResponseWriter, r *http.Request) (err error) {
 	w.Header().Set("Content-Type", "application/json")
 	// read in request
 	len := r.ContentLength
@@ -34,7 +34,7 @@ func Login(w http.ResponseWriter, r *http.Request) (err error) {
 	}
 	queries := mux.Vars(r)
 	if titleOrID, ok := queries["titleOrID"]; ok {
-		cr, err := repository.CS.Retrieve(titleOrID)
+		cr, err := api.Rooms.Retrieve(titleOrID)
 		if err != nil {
 			config.Info("erroneous chats API request", r, err)
 			return err
@@ -43,14 +43,33 @@ func Login(w http.ResponseWriter, r *http.Request) (err error) {
 			// Ignore public room
 			config.ReportStatus(w, true, nil)
 		} else if features.MatchesPassword(c.Password, *cr) {
+			// Registered users are named by their session, nobody else may use their name
+			sess, err := session(r)
+			if err != nil {
+				return err
+			}
+			if sess != nil {
+				c.User = sess.Username
+			} else if features.IsRegistered(c.User) {
+				return &config.APIError{
+					Code:  204,
+					Field: "name",
+				}
+			}
 			if c.User == "" {
 				return &config.APIError{
 					Code:  303,
 					Field: "name",
 				}
 			}
+			if features.IsBanned(cr, c.User) {
+				return &config.APIError{
+					Code:  111,
+					Field: "name",
+				}
+			}
 			// Success! Generate token using secret key concatenated with room's password (length > 32)
-			tokenString, err := config.EncodeJWT(&c, cr, generateUniqueKey(cr))
+			tokenString, err := config.EncodeJWT(&c, cr, features.RoleOf(cr, c.User), generateUniqueKey(cr))
 			if err != nil {
 				return err
 			}
@@ -59,11 +78,13 @@ func Login(w http.ResponseWriter, r *http.Request) (err error) {
 				Outcome  bool   `json:"status"`
 				Username string `json:"name"`
 				RoomID   int    `json:"room_id"`
+				Role     string `json:"role"`
 				Token    string `json:"token"`
 			}{
 				Outcome:  true,
 				Username: c.User,
 				RoomID:   cr.ID,
+				Role:     features.RoleOf(cr, c.User),
 				Token:    tokenString,
 			})
 			w.WriteHeader(http.StatusCreated)
@@ -83,11 +104,11 @@ func Login(w http.ResponseWriter, r *http.Request) (err error) {
 
 // RenewToken Refreshes tokens before they expire
 // GET /chats/{titleOrID}/token/renew
-func RenewToken(w http.ResponseWriter, r *http.Request) (err error) {
+func (api *API) RenewToken(w http.ResponseWriter, r *http.Request) (err error) {
 	w.Header().Set("Content-Type", "application/json")
 	queries := mux.Vars(r)
 	if titleOrID, ok := queries["titleOrID"]; ok {
-		cr, err := repository.CS.Retrieve(titleOrID)
+		cr, err := api.Rooms.Retrieve(titleOrID)
 		if err != nil {
 			config.Info("erroneous chats API request", r, err)
 			return err
@@ -109,7 +130,14 @@ func RenewToken(w http.ResponseWriter, r *http.Request) (err error) {
 			if err = config.ParseJWT(tknStr, claim, generateUniqueKey(cr)); err != nil {
 				return err
 			}
-			// Success! Generate token
+			if features.IsBanned(cr, claim.Username) {
+				return &config.APIError{
+					Code:  111,
+					Field: "name",
+				}
+			}
+			// Success! Generate token carrying the current role
+			claim.Role = features.RoleOf(cr, claim.Username)
 			tokenStringNew, err := claim.RefreshJWT(generateUniqueKey(cr))
 			if err != nil {
 				return err
@@ -119,11 +147,13 @@ func RenewToken(w http.ResponseWriter, r *http.Request) (err error) {
 				Outcome  bool   `json:"status"`
 				Username string `json:"name"`
 				RoomID   int    `json:"room_id"`
+				Role     string `json:"role"`
 				Token    string `json:"token"`
 			}{
 				Outcome:  true,
 				Username: claim.Username,
 				RoomID:   cr.ID,
+				Role:     claim.Role,
 				Token:    tokenStringNew,
 			})
 			w.WriteHeader(http.StatusCreated)
@@ -135,8 +165,78 @@ func RenewToken(w http.ResponseWriter, r *http.Request) (err error) {
 	return
 }
 
-// Authorize will call the handler if authorization bearer token is valid. Otherwise, it will send a failed outcome
-func Authorize(h ErrHandler) ErrHandler {
+// Logout revokes a token before it expires and closes the connections of its user to the room
+// DELETE /chats/{titleOrID}/token
+// Public rooms issue no tokens, so there is nothing to log out of.
+func (api *API) Logout(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	queries := mux.Vars(r)
+	if titleOrID, ok := queries["titleOrID"]; ok {
+		cr, err := api.Rooms.Retrieve(titleOrID)
+		if err != nil {
+			config.Info("erroneous chats API request", r, err)
+			return err
+		}
+		tknStr, err := extractJwtToken(r)
+		if err != nil || cr.Type == models.PublicRoom {
+			return &config.APIError{
+				Code:  403,
+				Field: "token",
+			}
+		}
+		claim := &config.Claims{}
+		if err = config.ParseJWT(tknStr, claim, generateUniqueKey(cr)); err != nil {
+			return err
+		}
+		if err = claim.Revoke(); err != nil {
+			return err
+		}
+		config.Info("revoked token of", claim.Username, "in chat room:", cr.Title)
+		// Open connections were authorized by a token that is no longer valid
+		if claim.Username != "" {
+			cr.Broker.DisconnectUsers(models.CloseReauthenticate, "logged out", claim.Username)
+		}
+		config.ReportStatus(w, true, nil)
+	}
+	return
+}
+
+// routeActions is the action each authorized route performs, by method and path template.
+// Routes missing from it are refused.
+var routeActions = map[string]string{
+	"GET /chats/{titleOrID}":                                   features.ReadRoom,
+	"PUT /chats/{titleOrID}":                                   features.UpdateRoom,
+	"PUT /chats/{titleOrID}/password":                          features.ChangePassword,
+	"DELETE /chats/{titleOrID}":                                features.DeleteRoom,
+	"PUT /chats/{titleOrID}/roles/{username}":                  features.ManageRoles,
+	"POST /chats/{titleOrID}/moderation":                       features.ModerateUsers,
+	"DELETE /chats/{titleOrID}/moderation/{action}/{username}": features.ModerateUsers,
+	"GET /chats/{titleOrID}/messages":                          features.ReadRoom,
+	"POST /chats/{titleOrID}/messages":                         models.Broadcast,
+	"GET /chats/{titleOrID}/messages/{id}/thread":              features.ReadRoom,
+	"GET /chats/{titleOrID}/messages/{id}/revisions":           features.ReadRoom,
+	"POST /chats/{titleOrID}/attachments":                      models.Broadcast,
+	"GET /chats/{titleOrID}/attachments/{id}":                  features.ReadRoom,
+	"GET /chats/{titleOrID}/ws":                                features.ReadRoom,
+	"GET /chats/{titleOrID}/events":                            features.ReadRoom,
+}
+
+// routeAction returns the action performed by the route matching a request
+func routeAction(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return routeActions[r.Method+" "+tpl]
+}
+
+// Authorize will call the handler if authorization bearer token is valid. Otherwise, it will send a failed outcome.
+// The role of the user must also permit the action of the route.
+func (api *API) Authorize(h ErrHandler) ErrHandler {
 	return func(w http.ResponseWriter, r *http.Request) (err error) {
 		// Skip authorization for special case of GET /chats/<id> for now
 		// TODO: Rewrite client-side app to request token before GET chat room
@@ -145,11 +245,12 @@ func Authorize(h ErrHandler) ErrHandler {
 		}
 		queries := mux.Vars(r)
 		if titleOrID, ok := queries["titleOrID"]; ok {
-			cr, err := repository.CS.Retrieve(titleOrID)
+			cr, err := api.Rooms.Retrieve(titleOrID)
 			if err != nil {
 				config.Info("erroneous chats API request", r, err)
 				return err
 			}
+			var claim *config.Claims
 			if cr.Type != models.PublicRoom {
 				// Check authorization header
 				// Get the JWT string from the cookie
@@ -160,11 +261,34 @@ func Authorize(h ErrHandler) ErrHandler {
 						Field: "token",
 					}
 				}
-				claim := &config.Claims{}
+				claim = &config.Claims{}
 				err = config.ParseJWT(tknStr, claim, generateUniqueKey(cr))
 				if err != nil {
 					return err
 				}
+			} else if claim, err = session(r); err != nil {
+				// Public rooms need no token, but a broken one is still refused
+				return err
+			}
+			var username string
+			if claim != nil {
+				// Roles may have changed since the token was issued
+				claim.Role = features.RoleOf(cr, claim.Username)
+				username = claim.Username
+				r = r.WithContext(context.WithValue(r.Context(), claimsKey, claim))
+			}
+			// Tokens issued before a ban are refused as well
+			if username != "" && features.IsBanned(cr, username) {
+				return &config.APIError{
+					Code:  111,
+					Field: "name",
+				}
+			}
+			if !features.Permitted(cr, username, routeAction(r)) {
+				return &config.APIError{
+					Code:  104,
+					Field: "role",
+				}
 			}
 
 			// Success, call h(w,r)
@@ -174,6 +298,33 @@ func Authorize(h ErrHandler) ErrHandler {
 	}
 }
 
+type contextKey int
+
+// claimsKey stores the Claims of the token a request was authorized with in its context
+const claimsKey contextKey = iota
+
+// identity returns the username authenticated by the token of a request passed through Authorize.
+// It is empty for anonymous users of public rooms.
+func identity(r *http.Request) string {
+	if claim, ok := r.Context().Value(claimsKey).(*config.Claims); ok {
+		return claim.Username
+	}
+	return ""
+}
+
+// session parses the session token of a registered user. Requests without a token yield no Claims.
+func session(r *http.Request) (*config.Claims, error) {
+	tknStr, err := extractJwtToken(r)
+	if err != nil {
+		return nil, nil
+	}
+	claim := &config.Claims{}
+	if err = config.ParseJWT(tknStr, claim, SecretKey); err != nil {
+		return nil, err
+	}
+	return claim, nil
+}
+
 // Strips 'Token' or 'Bearer' prefix from token string
 func stripTokenPrefix(tok string) string {
 	// split token to 2 parts
@@ -184,7 +335,7 @@ func stripTokenPrefix(tok string) string {
 	return tokenParts[1]
 }
 
-// extractJwtToken extracts token from Authorization header
+// extractJwtToken extracts token from Authorization header, WebSocket protocol header or token query parameter
 func extractJwtToken(req *http.Request) (string, error) {
 	// Strip "Bearer" from Authorization: Bearer <token>
 	tokenString := stripTokenPrefix(req.Header.Get("Authorization"))
@@ -192,6 +343,10 @@ func extractJwtToken(req *http.Request) (string, error) {
 		// Want to check
 		tokenString = req.Header.Get("Sec-WebSocket-Protocol")
 	}
+	if tokenString == "" {
+		// EventSource cannot set headers either
+		tokenString = req.URL.Query().Get("token")
+	}
 
 	if tokenString == "" {
 		return "", &data.APIError{Code: 403, Field: "token"}
@@ -10,6 +10,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestLogin(t *testing.T) {
@@ -81,7 +84,7 @@ func TestRenewToken(t *testing.T) {
 	for _, tc := range cases {
 		result = nil
 		t.Run(tc.roomID, func(t *testing.T) {
-			cr, _ := repository.CS.Retrieve(tc.roomID)
+			cr, _ := rooms.Retrieve(tc.roomID)
 			// Refresh writer
 			writer = httptest.NewRecorder()
 			// URI and HTTP method
@@ -114,16 +117,93 @@ func TestRenewToken(t *testing.T) {
 	}
 }
 
+func TestLogout(t *testing.T) {
+	cases := []struct {
+		roomID                 string
+		expectedOutcome        bool
+		expectedHTTPStatusCode int
+	}{
+		// Public rooms issue no tokens to revoke
+		{"1", false, 403},
+		{"2", false, 403},
+		{"2", true, 200},
+		{"does not exist", false, 404},
+	}
+	var result map[string]interface{}
+	for _, tc := range cases {
+		result = nil
+		t.Run(tc.roomID, func(t *testing.T) {
+			cr, _ := rooms.Retrieve(tc.roomID)
+			// Refresh writer
+			writer = httptest.NewRecorder()
+			// URI and HTTP method
+			request, _ := http.NewRequest("DELETE", fmt.Sprintf("/chats/%s/token", tc.roomID), nil)
+			request.Header.Set("Content-Type", "application/json")
+			if tc.roomID != "does not exist" && cr.Type != models.PublicRoom {
+				setJWTHeaders(t, request, tc.roomID, tc.expectedOutcome)
+			}
+			// Send request
+			router.ServeHTTP(writer, request)
+			// Check assertions
+			if writer.Code != tc.expectedHTTPStatusCode {
+				t.Errorf("Response code is %v", writer.Code)
+			}
+			if err := json.Unmarshal(writer.Body.Bytes(), &result); err != nil {
+				t.Fatal("Unexpected result logging out. Response: ", writer.Body.String())
+			}
+			if result["status"] != tc.expectedOutcome {
+				t.Error("Unexpected result logging out. Response: ", writer.Body.String())
+			}
+		})
+	}
+}
+
+func TestLogoutDisconnects(t *testing.T) {
+	rooms := repository.NewChatServer()
+	rooms.Init()
+	router := NewRouter(NewAPI(rooms, accounts))
+	cr := &models.ChatRoom{Title: "Logout Chat", Type: models.PrivateRoom, Password: "123abc123abc"}
+	if err := rooms.Add(cr); err != nil {
+		t.Fatal(err)
+	}
+	tkn, _ := config.EncodeJWT(&models.ChatEvent{User: "test_user", RoomID: cr.ID}, cr, models.Member, generateUniqueKey(cr))
+	s := httptest.NewServer(router)
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("%s/chats/%d/ws?token=%s", httpToWS(t, s.URL), cr.ID, tkn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	sendWSMessage(t, ws, models.ChatEvent{EventType: models.Subscribe, User: "test_user"})
+	receiveWSMessage(t, ws)
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("DELETE", fmt.Sprintf("/chats/%d/token", cr.ID), nil)
+	request.Header.Set("Authorization", "Bearer "+tkn)
+	router.ServeHTTP(writer, request)
+	if writer.Code != 200 {
+		t.Fatalf("Response code is %v", writer.Code)
+	}
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err = ws.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !websocket.IsCloseError(err, models.CloseReauthenticate) {
+		t.Errorf("Expected the connection to be closed with %d, got %v", models.CloseReauthenticate, err)
+	}
+}
+
 // Generates a token and sets it in the request Authorization HTTP header under Bearer scheme
 // If intendedValidity is set to false, this will set a faulty token
 // This should only be used as a band-aid to keep tests simple and independent for now
 func setJWTHeaders(t *testing.T, r *http.Request, id string, intendedValidity bool) {
 	t.Helper()
-	cr, _ := repository.CS.Retrieve(id)
+	cr, _ := rooms.Retrieve(id)
 	var myCr *models.ChatRoom = &models.ChatRoom{Password: cr.Password, ID: cr.ID, Title: cr.Title}
 	if !intendedValidity {
 		myCr.Password = "bogus_incorrect_password"
 	}
-	tkn, _ := config.EncodeJWT(&models.ChatEvent{User: "test_user", RoomID: cr.ID}, cr, generateUniqueKey(myCr))
+	tkn, _ := config.EncodeJWT(&models.ChatEvent{User: "test_user", RoomID: cr.ID}, cr, models.Member, generateUniqueKey(myCr))
 	r.Header.Set("Authorization", "Bearer "+tkn)
 }
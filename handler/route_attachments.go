@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// multipartOverhead allows for the headers and boundaries around an uploaded file
+const multipartOverhead = 64 << 10
+
+// HandleUpload stores a file uploaded as the "file" field of a multipart form.
+// Its type is sniffed from the content rather than trusted from the client.
+// POST /chats/{titleOrID}/attachments
+func (api *API) HandleUpload(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	titleOrID, ok := mux.Vars(r)["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Info("erroneous attachments API request", r, err)
+		return err
+	}
+	if r.ContentLength > features.MaxAttachmentSize+multipartOverhead {
+		return &config.APIError{Code: 109, Field: "file"}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, features.MaxAttachmentSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return &config.APIError{Code: 105, Field: "file"}
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return &config.APIError{Code: 105, Field: "file"}
+		} else if err != nil {
+			return &config.APIError{Code: 109, Field: "file"}
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		// Sniff the type from the first bytes without consuming them
+		content := bufio.NewReaderSize(part, 512)
+		head, _ := content.Peek(512)
+		contentType := http.DetectContentType(head)
+		if !features.AttachmentAllowed(contentType) {
+			return &config.APIError{Code: 110, Field: contentType}
+		}
+		a := &models.Attachment{
+			ID:          features.NewEventID(),
+			RoomID:      cr.ID,
+			Name:        filepath.Base(part.FileName()),
+			ContentType: contentType,
+			CreatedAt:   time.Now(),
+		}
+		if err = cr.Attachments.Add(a, &sizeLimit{r: content, n: features.MaxAttachmentSize}); err != nil {
+			config.Danger("Error storing attachment", err.Error())
+			return err
+		}
+		config.Info("uploaded attachment to chat room:", cr.Title)
+		res, _ := json.Marshal(a)
+		w.WriteHeader(http.StatusCreated)
+		if _, err := w.Write(res); err != nil {
+			config.Danger("Error writing", res)
+		}
+		return nil
+	}
+}
+
+// sizeLimit fails reads once more than n bytes were read from r, so oversized files are never stored
+type sizeLimit struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimit) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n, &config.APIError{Code: 109, Field: "file"}
+	}
+	return n, err
+}
+
+// HandleDownload returns the content of an attachment
+// GET /chats/{titleOrID}/attachments/{id}
+func (api *API) HandleDownload(w http.ResponseWriter, r *http.Request) (err error) {
+	vars := mux.Vars(r)
+	titleOrID, ok := vars["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Info("erroneous attachments API request", r, err)
+		return err
+	}
+	a, content, err := cr.Attachments.Open(cr.ID, vars["id"])
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	// Only images are displayed inline, anything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(a.ContentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, content); err != nil {
+		config.Danger("Error writing attachment", a.ID, err.Error())
+	}
+	return nil
+}
@@ -4,18 +4,19 @@ import (
 	"api_chat/config"
 	"api_chat/features"
 	"api_chat/models"
-	"api_chat/repository"
 	"encoding/json"
 	"github.com/gorilla/mux"
+	"io"
 	"net/http"
+	"strings"
 )
 
 // HandleRoom main handler function
-func HandleRoom(w http.ResponseWriter, r *http.Request) (err error) {
+func (api *API) HandleRoom(w http.ResponseWriter, r *http.Request) (err error) {
 	queries := mux.Vars(r)
 	w.Header().Set("Content-Type", "application/json")
 	if titleOrID, ok := queries["titleOrID"]; ok {
-		cr, err := repository.CS.Retrieve(titleOrID)
+		cr, err := api.Rooms.Retrieve(titleOrID)
 		if err != nil {
 			config.Info("erroneous chats API request", r, err)
 			return err
@@ -25,10 +26,10 @@ func HandleRoom(w http.ResponseWriter, r *http.Request) (err error) {
 			err = handleGet(w, cr)
 			return err
 		case "PUT":
-			err = handlePut(w, r, cr, titleOrID)
+			err = api.handlePut(w, r, cr, titleOrID)
 			return err
 		case "DELETE":
-			err = handleDelete(w, cr)
+			err = api.handleDelete(w, cr)
 			return err
 		}
 	} else {
@@ -40,6 +41,76 @@ func HandleRoom(w http.ResponseWriter, r *http.Request) (err error) {
 	return err
 }
 
+// RoomPage is a page of listed chat rooms
+type RoomPage struct {
+	Rooms  []roomListing `json:"rooms"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// roomListing hides the password hash of a listed room and adds its participant count
+type roomListing struct {
+	*models.ChatRoom
+	Password     string `json:"password,omitempty"`
+	Participants int    `json:"participants"`
+}
+
+// HandleList lists all non-hidden chat rooms
+// GET /chats?visibility=<public|private>&q=<title>&sort=<created|updated|participants>&order=<asc|desc>&limit=<n>&offset=<n>
+func (api *API) HandleList(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	params := r.URL.Query()
+	q := features.RoomQuery{
+		Visibility: strings.ToLower(params.Get("visibility")),
+		Title:      params.Get("q"),
+		Sort:       strings.ToLower(params.Get("sort")),
+	}
+	if q.Visibility != "" && q.Visibility != models.PublicRoom && q.Visibility != models.PrivateRoom {
+		return &config.APIError{Code: 106, Field: "visibility"}
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = features.SortCreated
+	case features.SortCreated, features.SortUpdated, features.SortParticipants:
+	default:
+		return &config.APIError{Code: 106, Field: "sort"}
+	}
+	switch strings.ToLower(params.Get("order")) {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return &config.APIError{Code: 106, Field: "order"}
+	}
+	if q.Limit, err = queryInt(r, "limit", defaultPageSize); err != nil {
+		return
+	}
+	if q.Limit < 1 || q.Limit > maxPageSize {
+		return &config.APIError{Code: 106, Field: "limit"}
+	}
+	if q.Offset, err = queryInt(r, "offset", 0); err != nil {
+		return
+	}
+	if q.Offset < 0 {
+		return &config.APIError{Code: 106, Field: "offset"}
+	}
+	rooms, err := api.Rooms.Chats()
+	if err != nil {
+		return
+	}
+	rooms, total := features.ListRooms(rooms, q)
+	page := RoomPage{Rooms: make([]roomListing, len(rooms)), Total: total, Limit: q.Limit, Offset: q.Offset}
+	for i := range rooms {
+		page.Rooms[i] = roomListing{ChatRoom: &rooms[i], Participants: features.Participants(rooms[i])}
+	}
+	res, _ := json.Marshal(page)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
 // Retrieve a chat room
 // GET /chat/1
 func handleGet(w http.ResponseWriter, cr *models.ChatRoom) (err error) {
@@ -56,7 +127,7 @@ func handleGet(w http.ResponseWriter, cr *models.ChatRoom) (err error) {
 
 // HandlePost Create a ChatRoom
 // POST /chats
-func HandlePost(w http.ResponseWriter, r *http.Request) (err error) {
+func (api *API) HandlePost(w http.ResponseWriter, r *http.Request) (err error) {
 	w.Header().Set("Content-Type", "application/json")
 	// read in request
 	contentLength := r.ContentLength
@@ -70,12 +141,21 @@ func HandlePost(w http.ResponseWriter, r *http.Request) (err error) {
 		config.Warning("error encountered reading POST:", err.Error())
 		return err
 	}
-	if err = repository.CS.Add(&cr); err != nil {
+	// Registered users own the rooms they create
+	sess, err := session(r)
+	if err != nil {
+		return err
+	}
+	cr.Owner = ""
+	if sess != nil {
+		cr.Owner = sess.Username
+	}
+	if err = api.Rooms.Add(&cr); err != nil {
 		config.Warning("error encountered adding chat room:", err.Error())
 		return err
 	}
 	// Retrieve updated object
-	createdChatRoom, err := repository.CS.Retrieve(cr.Title)
+	createdChatRoom, err := api.Rooms.Retrieve(cr.Title)
 	if err != nil {
 		return err
 	}
@@ -89,7 +169,7 @@ func HandlePost(w http.ResponseWriter, r *http.Request) (err error) {
 
 // Update a room
 // PUT /chats/<id>
-func handlePut(w http.ResponseWriter, r *http.Request, currentChatRoom *models.ChatRoom, title string) (err error) {
+func (api *API) handlePut(w http.ResponseWriter, r *http.Request, currentChatRoom *models.ChatRoom, title string) (err error) {
 	var cr models.ChatRoom
 	contentLength := r.ContentLength
 	body := make([]byte, contentLength)
@@ -100,12 +180,12 @@ func handlePut(w http.ResponseWriter, r *http.Request, currentChatRoom *models.C
 		config.Warning("error encountered updating chat room:", err.Error())
 		return
 	}
-	if err = repository.CS.Update(title, &cr); err != nil {
+	if err = api.Rooms.Update(title, &cr); err != nil {
 		config.Warning("error encountered updating chat room:", cr, err.Error())
 		return
 	}
 	// Retrieve updated object
-	modifiedChatRoom, err := repository.CS.RetrieveID(currentChatRoom.ID)
+	modifiedChatRoom, err := api.Rooms.RetrieveID(currentChatRoom.ID)
 	if err != nil {
 		return err
 	}
@@ -117,10 +197,95 @@ func handlePut(w http.ResponseWriter, r *http.Request, currentChatRoom *models.C
 	return
 }
 
+// HandlePassword changes the password of a private or hidden room. Tokens are signed with the password,
+// so all tokens of the room stop working: connected clients are disconnected and the caller receives a new token.
+// PUT /chats/{titleOrID}/password
+func (api *API) HandlePassword(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	cr, err := api.Rooms.Retrieve(mux.Vars(r)["titleOrID"])
+	if err != nil {
+		config.Info("erroneous password API request", r, err)
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		config.Danger("Error reading", r, err.Error())
+		return err
+	}
+	var change struct {
+		Password string `json:"password"`
+	}
+	if err = json.Unmarshal(body, &change); err != nil {
+		return &config.APIError{Code: 103}
+	}
+	if err = api.Rooms.UpdatePassword(cr, change.Password); err != nil {
+		config.Warning("error encountered changing password of chat room:", err.Error())
+		return err
+	}
+	features.Reauthenticate(cr)
+	config.Info("changed password of chat room:", cr.Title)
+	username := identity(r)
+	role := features.RoleOf(cr, username)
+	tokenString, err := config.EncodeJWT(&models.ChatEvent{User: username}, cr, role, generateUniqueKey(cr))
+	if err != nil {
+		return err
+	}
+	jsonEncoding, _ := json.Marshal(struct {
+		Outcome  bool   `json:"status"`
+		Username string `json:"name"`
+		RoomID   int    `json:"room_id"`
+		Role     string `json:"role"`
+		Token    string `json:"token"`
+	}{
+		Outcome:  true,
+		Username: username,
+		RoomID:   cr.ID,
+		Role:     role,
+		Token:    tokenString,
+	})
+	if _, err := w.Write(jsonEncoding); err != nil {
+		config.Danger("Error writing", jsonEncoding)
+	}
+	return
+}
+
+// HandleRole grants a role to a registered user of a room. Granting the member role revokes the previous one.
+// PUT /chats/{titleOrID}/roles/{username}
+func (api *API) HandleRole(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	cr, err := api.Rooms.Retrieve(vars["titleOrID"])
+	if err != nil {
+		config.Info("erroneous roles API request", r, err)
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		config.Danger("Error reading", r, err.Error())
+		return err
+	}
+	var grant struct {
+		Role string `json:"role"`
+	}
+	if err = json.Unmarshal(body, &grant); err != nil {
+		return &config.APIError{Code: 103}
+	}
+	if err = api.Rooms.SetRole(cr, vars["username"], strings.ToLower(grant.Role)); err != nil {
+		config.Warning("error encountered granting role:", err.Error())
+		return err
+	}
+	config.Info("granted role", grant.Role, "to", vars["username"], "in chat room:", cr.Title)
+	res, _ := features.ToJSON(*cr)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
 // Delete a room
 // DELETE /chat/<id>
-func handleDelete(w http.ResponseWriter, cr *models.ChatRoom) (err error) {
-	err = repository.CS.Delete(cr)
+func (api *API) handleDelete(w http.ResponseWriter, cr *models.ChatRoom) (err error) {
+	err = api.Rooms.Delete(cr)
 	if err != nil {
 		config.Warning("error encountered deleting chat room:", err.Error())
 		return
@@ -2,9 +2,13 @@ package handler
 
 import (
 	"api_chat/config"
-	"api_chat/server"
+	"api_chat/features"
+	"api_chat/models"
+	"api_chat/repository"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -12,13 +16,16 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/DavidSchott/chitchat/data"
 	"github.com/gorilla/mux"
 )
 
 var writer *httptest.ResponseRecorder
 var router *mux.Router
 
+// rooms and accounts back the router under test, in memory
+var rooms *repository.ChatServer
+var accounts *repository.AccountLog
+
 func TestMain(m *testing.M) {
 	setUp()
 	code := m.Run()
@@ -27,8 +34,16 @@ func TestMain(m *testing.M) {
 }
 
 func setUp() {
-	router = server.Mux
-	if err := data.CS.Add(&data.ChatRoom{
+	config.Logger = log.New(io.Discard, "", 0)
+	rooms = repository.NewChatServer()
+	rooms.Init()
+	accounts = repository.NewAccountLog()
+	features.IsRegistered = func(username string) bool {
+		_, err := accounts.Retrieve(username)
+		return err == nil
+	}
+	router = NewRouter(NewAPI(rooms, accounts))
+	if err := rooms.Add(&models.ChatRoom{
 		Title:       "Hidden Chat",
 		Description: "This is the hidden chat!",
 		Type:        "hidden",
@@ -36,7 +51,7 @@ func setUp() {
 	}); err != nil {
 		config.Danger("Error setting up tests", err.Error())
 	}
-	if err := data.CS.Add(&data.ChatRoom{
+	if err := rooms.Add(&models.ChatRoom{
 		Title:       "Public Test Chat",
 		Description: "This is the public chat!",
 		Type:        "public",
@@ -46,12 +61,12 @@ func setUp() {
 }
 
 func tearDown() {
-	cr, _ := data.CS.Retrieve("2")
-	if err := data.CS.Delete(cr); err != nil {
+	cr, _ := rooms.Retrieve("2")
+	if err := rooms.Delete(cr); err != nil {
 		config.Danger("Error tearing down tests", err.Error())
 	}
-	cr2, _ := data.CS.Retrieve("3")
-	if err := data.CS.Delete(cr2); err != nil {
+	cr2, _ := rooms.Retrieve("3")
+	if err := rooms.Delete(cr2); err != nil {
 		config.Danger("Error tearing down tests", err.Error())
 	}
 }
@@ -76,12 +91,12 @@ func TestHandlePost(t *testing.T) {
 		{"bad hidden room", "password shall not be too short  for hidden rooms", "hidden", "", false, 400, 105},
 		{"weird public room", "passwords given to a public room shall fail to avoid accidents", "public", "badpwd", false, 400, 105},
 	}
-	var res data.ChatRoom
-	var failedOutcome data.Outcome
+	var res models.ChatRoom
+	var failedOutcome config.Outcome
 	var matchConditions bool
 	for _, tc := range cases {
-		failedOutcome = data.Outcome{}
-		res = data.ChatRoom{}
+		failedOutcome = config.Outcome{}
+		res = models.ChatRoom{}
 		t.Run(tc.title, func(t *testing.T) {
 			// Refresh writer
 			writer = httptest.NewRecorder()
@@ -130,18 +145,21 @@ func TestHandleGet(t *testing.T) {
 		{"secret room", "this is a secret room", 200, true},
 		{"this room does not exist", "this is a problem", 404, false},
 	}
-	var cr data.ChatRoom
-	var failOutcome data.Outcome
+	var cr models.ChatRoom
+	var failOutcome config.Outcome
 	var matchConditions bool
 	for _, tc := range cases {
-		failOutcome = data.Outcome{}
-		cr = data.ChatRoom{}
+		failOutcome = config.Outcome{}
+		cr = models.ChatRoom{}
 		t.Run(tc.titleOrID, func(t *testing.T) {
 			// Refresh writer TODO: Recycle old one instead.
 			writer = httptest.NewRecorder()
 			// Craft HTTP req
 			request, _ := http.NewRequest("GET", fmt.Sprintf("/chats/%s", tc.titleOrID), nil)
 			request.Header.Set("Content-Type", "application/json")
+			if cr, err := rooms.Retrieve(tc.titleOrID); err == nil && cr.Type != models.PublicRoom {
+				setJWTHeaders(t, request, tc.titleOrID, true)
+			}
 			router.ServeHTTP(writer, request)
 			// Check assertions
 			if writer.Code != tc.expectedHTTPStatusCode {
@@ -186,14 +204,14 @@ func TestHandlePut(t *testing.T) {
 		{"5", "private room renamed failure", "bad password", "private", false, 403, 403},
 		{"6", "hidden room renamed", "renamed", "hidden", true, 200, 0},
 	}
-	var res data.ChatRoom
-	var failedOutcome data.Outcome
+	var res models.ChatRoom
+	var failedOutcome config.Outcome
 	var matchConditions bool
 	for _, tc := range cases {
-		failedOutcome = data.Outcome{}
-		res = data.ChatRoom{}
+		failedOutcome = config.Outcome{}
+		res = models.ChatRoom{}
 		t.Run(tc.titleOrID, func(t *testing.T) {
-			cr, _ := data.CS.Retrieve(tc.titleOrID)
+			cr, _ := rooms.Retrieve(tc.titleOrID)
 			// Refresh writer
 			writer = httptest.NewRecorder()
 			// JSON body
@@ -202,7 +220,7 @@ func TestHandlePut(t *testing.T) {
 			// URI and HTTP method
 			request, _ := http.NewRequest("PUT", fmt.Sprintf("/chats/%s", tc.titleOrID), requestBody)
 			request.Header.Set("Content-Type", "application/json")
-			if cr.Type != data.PublicRoom {
+			if cr.Type != models.PublicRoom {
 				setJWTHeaders(t, request, tc.titleOrID, tc.expectedOutcome)
 			}
 			// Send request
@@ -231,31 +249,80 @@ func TestHandlePut(t *testing.T) {
 	}
 }
 
+func TestHandlePassword(t *testing.T) {
+	cases := []struct {
+		name                   string
+		titleOrID              string
+		password               string
+		authenticated          bool
+		expectedHTTPStatusCode int
+		expectedAPIErrorCode   int
+	}{
+		// Rooms without an owner, such as the public one, may be updated by anybody, but their password only changed by an owner
+		{"public room", "1", "password456", false, 401, 104},
+		{"public room without password", "1", "", false, 401, 104},
+		{"ownerless room", "2", "password456", true, 401, 104},
+	}
+	var result map[string]interface{}
+	for _, tc := range cases {
+		result = nil
+		t.Run(tc.name, func(t *testing.T) {
+			cr, _ := rooms.Retrieve(tc.titleOrID)
+			password := cr.Password
+			// Refresh writer
+			writer = httptest.NewRecorder()
+			requestBody := strings.NewReader(fmt.Sprintf(`{"password":"%s"}`, tc.password))
+			request, _ := http.NewRequest("PUT", fmt.Sprintf("/chats/%s/password", tc.titleOrID), requestBody)
+			request.Header.Set("Content-Type", "application/json")
+			if tc.authenticated {
+				setJWTHeaders(t, request, tc.titleOrID, true)
+			}
+			// Send request
+			router.ServeHTTP(writer, request)
+			// Check assertions
+			if writer.Code != tc.expectedHTTPStatusCode {
+				t.Errorf("Unexpected response code is %v", writer.Code)
+			}
+			if err := json.Unmarshal(writer.Body.Bytes(), &result); err != nil {
+				t.Fatal("Error parsing", writer.Body.String(), err.Error())
+			}
+			apiErr, _ := result["error"].(map[string]interface{})
+			if result["status"] != false || apiErr == nil || apiErr["code"] != float64(tc.expectedAPIErrorCode) {
+				t.Error("Unexpected result changing password. Response: ", writer.Body.String())
+			}
+			if cr.Password != password {
+				t.Fatal("SECURITY ISSUE: PASSWORD UNEXPECTEDLY CHANGED", cr.Title)
+			}
+		})
+	}
+}
+
 func TestHandleDelete(t *testing.T) {
 	cases := []struct {
 		titleOrID              string
 		expectedHTTPStatusCode int
 		expectedOutcome        bool
 	}{
+		// Rooms were renamed by TestHandlePut
 		{"1", 200, true},
-		{"public room", 200, true},
-		{"private room", 403, false},
+		{"4", 200, true},
+		{"5", 403, false},
 		{"5", 403, false},
-		{"private room", 200, true},
-		{"secret room", 200, true},
+		{"5", 200, true},
+		{"6", 200, true},
 		{"does not exist", 404, false},
 	}
-	var result data.Outcome
+	var result config.Outcome
 	var matchConditions bool
 	for _, tc := range cases {
-		result = data.Outcome{}
+		result = config.Outcome{}
 		t.Run(tc.titleOrID, func(t *testing.T) {
 			// Refresh writer TODO: Recycle old one instead.
 			writer = httptest.NewRecorder()
 			// Craft HTTP req
 			request, _ := http.NewRequest("DELETE", fmt.Sprintf("/chats/%s", tc.titleOrID), nil)
 			request.Header.Set("Content-Type", "application/json")
-			if tc.titleOrID != "does not exist" {
+			if cr, err := rooms.Retrieve(tc.titleOrID); err == nil && cr.Type != models.PublicRoom {
 				setJWTHeaders(t, request, tc.titleOrID, tc.expectedOutcome)
 			}
 			router.ServeHTTP(writer, request)
@@ -14,13 +14,17 @@ func (fn ErrHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 			apierr.SetMsg()
 			config.Warning("API error:", apierr.Error())
-			if apierr.Code == 101 || apierr.Code == 201 {
+			if apierr.Code == 101 || apierr.Code == 107 || apierr.Code == 108 || apierr.Code == 201 {
 				notFound(w, r)
+			} else if apierr.Code == 109 {
+				tooLarge(w, r)
+			} else if apierr.Code == 110 {
+				unsupportedMediaType(w, r)
 			} else if apierr.Code == 102 || apierr.Code == 202 || apierr.Code == 303 || apierr.Code == 105 {
 				badRequest(w, r)
 			} else if apierr.Code == 104 || apierr.Code == 204 || apierr.Code == 304 || apierr.Code == 401 || apierr.Code == 402 {
 				unauthorized(w, r)
-			} else if apierr.Code == 403 {
+			} else if apierr.Code == 403 || apierr.Code == 404 || apierr.Code == 111 || apierr.Code == 112 {
 				forbidden(w, r)
 			} else {
 				badRequest(w, r)
@@ -48,6 +52,16 @@ func forbidden(w http.ResponseWriter, r *http.Request) {
 	config.Warning("forbidden:", r.RequestURI, r.Body)
 }
 
+func tooLarge(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	config.Info("Request too large:", r.RequestURI)
+}
+
+func unsupportedMediaType(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusUnsupportedMediaType)
+	config.Info("Unsupported media type:", r.RequestURI)
+}
+
 func badRequest(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(400)
 	config.Info("Bad request:", r.RequestURI, r.Body)
@@ -4,8 +4,8 @@ import (
 	"api_chat/config"
 	"api_chat/features"
 	"api_chat/models"
-	"api_chat/repository"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -22,17 +22,21 @@ var (
 )
 
 // WebSocketHandler Upgrade to a ws connection
-// Add to active chat session
-// GET /chats/{titleOrID}/ws
-func WebSocketHandler(w http.ResponseWriter, r *http.Request) (err error) {
+// Add to active chat session. Reconnecting clients pass the last sequence number they received to resume.
+// GET /chats/{titleOrID}/ws?last_seq=<seq>
+func (api *API) WebSocketHandler(w http.ResponseWriter, r *http.Request) (err error) {
 	queries := mux.Vars(r)
 	if titleOrID, ok := queries["titleOrID"]; ok {
 		// Fetch room & authorize
-		cr, err := repository.CS.Retrieve(titleOrID)
+		cr, err := api.Rooms.Retrieve(titleOrID)
 		if err != nil {
 			config.Warning("Error retrieving room", r, err)
 			return err
 		}
+		lastSeq, err := queryInt(r, "last_seq", 0)
+		if err != nil {
+			return err
+		}
 		// Do stuff here:
 		wsConn, err := upgrade.Upgrade(w, r, nil)
 		if err != nil {
@@ -40,7 +44,9 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) (err error) {
 			config.Danger("error creating WebSocket: ", err)
 			return &config.APIError{Code: 301}
 		}
-		client := &models.Client{Room: cr, Conn: wsConn, Send: make(chan []byte)}
+		client := models.NewClient(cr, wsConn)
+		client.LastSeq = lastSeq
+		client.Identity = identity(r)
 		client.Room.Broker.OpenClient <- client
 
 		// Allow collection of memory referenced by the caller by doing all work in
@@ -53,3 +59,52 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) (err error) {
 
 	return
 }
+
+// EventStreamHandler streams the events of a room as Server-Sent Events, for clients that cannot use WebSockets.
+// Browsers resume automatically through the Last-Event-ID header.
+// GET /chats/{titleOrID}/events?last_seq=<seq>
+func (api *API) EventStreamHandler(w http.ResponseWriter, r *http.Request) (err error) {
+	titleOrID, ok := mux.Vars(r)["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Warning("Error retrieving room", r, err)
+		return err
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return &config.APIError{Code: 305}
+	}
+	lastSeq, err := queryInt(r, "last_seq", 0)
+	if err != nil {
+		return err
+	}
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if lastSeq, err = strconv.Atoi(id); err != nil {
+			return &config.APIError{Code: 106, Field: "Last-Event-ID"}
+		}
+	}
+	client := models.NewClient(cr, nil)
+	client.LastSeq = lastSeq
+	// Event stream clients never join, they are named after their token so sanctions and direct messages reach them
+	client.Identity = identity(r)
+	client.Username = client.Identity
+	cr.Broker.OpenClient <- client
+	defer func() {
+		cr.Broker.CloseClient <- client
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disable response buffering of reverse proxies such as nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	features.Replay(client)
+	features.EventStream(w, flusher.Flush, client, r.Context().Done())
+	return
+}
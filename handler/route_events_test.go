@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"api_chat/features"
+	"api_chat/models"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,8 +12,6 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
-
-	"github.com/DavidSchott/chitchat/data"
 )
 
 const WSHandshakeTimeOut = 45 * time.Second
@@ -39,14 +39,14 @@ func TestHandleWebSocket(t *testing.T) {
 			defer s.Close()
 			defer ws.Close()
 			// Join user to chat room
-			joinEvt := data.ChatEvent{EventType: data.Subscribe, User: tt.user}
+			joinEvt := models.ChatEvent{EventType: models.Subscribe, User: tt.user}
 			expectedEventResponse := joinEvt
 			expectedEventResponse.Msg = fmt.Sprintf("%s entered the room.", tt.user)
 			compareExpectedActualEvents(t, ws, joinEvt, expectedEventResponse)
 			// Send Chat Messages. Need to rewrite this test since design does not support multiple concurrent read/writes
 			/*for i := 0; i < tt.eventIterations; i++ {
 				msg := fmt.Sprintf("Test message %d for %s from %s", i, tt.name, tt.user)
-				sendEvt := data.ChatEvent{EventType: data.Broadcast, User: tt.user, Msg: msg, Color: "Red"}
+				sendEvt := models.ChatEvent{EventType: models.Broadcast, User: tt.user, Msg: msg, Color: "Red"}
 				compareExpectedActualEvents(t, ws, sendEvt, sendEvt)
 			}
 			*/
@@ -54,7 +54,7 @@ func TestHandleWebSocket(t *testing.T) {
 	}
 }
 
-func compareExpectedActualEvents(t *testing.T, ws *websocket.Conn, outEvt data.ChatEvent, expectedEvent data.ChatEvent) {
+func compareExpectedActualEvents(t *testing.T, ws *websocket.Conn, outEvt models.ChatEvent, expectedEvent models.ChatEvent) {
 	t.Helper()
 	sendWSMessage(t, ws, outEvt)
 	t.Log("Sending chat message: " + outEvt.Msg)
@@ -85,7 +85,7 @@ func newWSServer(t *testing.T, titleOrID string, h http.Handler) (*httptest.Serv
 	return s, ws
 }
 
-func sendWSMessage(t *testing.T, ws *websocket.Conn, ce data.ChatEvent) {
+func sendWSMessage(t *testing.T, ws *websocket.Conn, ce models.ChatEvent) {
 	t.Helper()
 
 	m, err := json.Marshal(ce)
@@ -97,7 +97,7 @@ func sendWSMessage(t *testing.T, ws *websocket.Conn, ce data.ChatEvent) {
 	}
 }
 
-func receiveWSMessage(t *testing.T, ws *websocket.Conn) data.ChatEvent {
+func receiveWSMessage(t *testing.T, ws *websocket.Conn) models.ChatEvent {
 	t.Helper()
 
 	_, m, err := ws.ReadMessage()
@@ -105,8 +105,8 @@ func receiveWSMessage(t *testing.T, ws *websocket.Conn) data.ChatEvent {
 		t.Fatalf("%v", err)
 	}
 
-	var reply data.ChatEvent
-	reply, err = data.ValidateEvent(m)
+	var reply models.ChatEvent
+	reply, err = features.ValidateEvent(m)
 	//err = json.Unmarshal(m, &reply)
 	if err != nil {
 		t.Fatal(err)
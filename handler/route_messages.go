@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// MessagePage is a page of stored ChatEvents, newest first.
+// NextBefore is the cursor to pass as ?before= to fetch the next (older) page and is omitted on the last page.
+type MessagePage struct {
+	Messages   []models.ChatEvent `json:"messages"`
+	NextBefore int                `json:"next_before,omitempty"`
+}
+
+// HandleMessages returns the history of a room
+// GET /chats/{titleOrID}/messages?before=<seq>&limit=<n>
+func (api *API) HandleMessages(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	titleOrID, ok := mux.Vars(r)["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Info("erroneous messages API request", r, err)
+		return err
+	}
+	before, err := queryInt(r, "before", 0)
+	if err != nil {
+		return err
+	}
+	limit, err := queryInt(r, "limit", defaultPageSize)
+	if err != nil {
+		return err
+	}
+	if limit < 1 || limit > maxPageSize {
+		return &config.APIError{Code: 106, Field: "limit"}
+	}
+	// Fetch one extra event to find out whether there is another page
+	messages, err := cr.Messages.Before(cr.ID, before, limit+1)
+	if err != nil {
+		return err
+	}
+	page := MessagePage{Messages: messages}
+	if len(messages) > limit {
+		page.Messages = messages[:limit]
+		page.NextBefore = page.Messages[limit-1].Seq
+	}
+	res, _ := json.Marshal(page)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
+// Thread is a message and the replies branching off it, oldest first
+type Thread struct {
+	Parent  models.ChatEvent   `json:"parent"`
+	Replies []models.ChatEvent `json:"replies"`
+}
+
+// HandleThread returns the replies to a message
+// GET /chats/{titleOrID}/messages/{id}/thread
+func (api *API) HandleThread(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	titleOrID, ok := vars["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Info("erroneous thread API request", r, err)
+		return err
+	}
+	var thread Thread
+	if thread.Parent, err = cr.Messages.Get(cr.ID, vars["id"]); err != nil {
+		return err
+	}
+	if thread.Replies, err = cr.Messages.Thread(cr.ID, vars["id"]); err != nil {
+		return err
+	}
+	res, _ := json.Marshal(thread)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
+// HandleRevisions returns the previous texts of an edited message, oldest first
+// GET /chats/{titleOrID}/messages/{id}/revisions
+func (api *API) HandleRevisions(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	titleOrID, ok := vars["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Info("erroneous revisions API request", r, err)
+		return err
+	}
+	revisions, err := cr.Messages.Revisions(cr.ID, vars["id"])
+	if err != nil {
+		return err
+	}
+	res, _ := json.Marshal(revisions)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
+// HandleSend posts a message to a room without opening a WebSocket
+// POST /chats/{titleOrID}/messages
+func (api *API) HandleSend(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	titleOrID, ok := mux.Vars(r)["titleOrID"]
+	if !ok {
+		return &config.APIError{Code: 101}
+	}
+	cr, err := api.Rooms.Retrieve(titleOrID)
+	if err != nil {
+		config.Info("erroneous messages API request", r, err)
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, models.MaxMessageSize+1))
+	if err != nil {
+		config.Danger("Error reading", r, err.Error())
+		return err
+	}
+	if len(body) > models.MaxMessageSize {
+		return &config.APIError{Code: 303, Field: "msg"}
+	}
+	evt, err := features.ValidateEventAs(body, identity(r))
+	if err != nil {
+		return err
+	}
+	if evt.Msg == "" && len(evt.Attachments) == 0 {
+		return &config.APIError{Code: 303, Field: "msg"}
+	}
+	evt.ID = features.NewEventID()
+	evt.Timestamp = time.Now()
+	if err = features.Send(&evt, cr); err != nil {
+		config.Danger("Error storing message", err.Error())
+		return err
+	}
+	config.Info("posted message to chat room:", cr.Title)
+	res, _ := json.Marshal(evt)
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
+// UnreadCount is the number of messages a user has not read in a room
+type UnreadCount struct {
+	RoomID   int    `json:"room_id"`
+	Title    string `json:"title"`
+	LastRead int    `json:"last_read"`
+	Unread   int    `json:"unread"`
+}
+
+// HandleUnread returns the unread messages of the user of a session in every public room
+// and every other listed room they read messages in
+// GET /me/unread
+// Anonymous users have no session: their read receipts are not theirs alone to look up.
+func (api *API) HandleUnread(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	sess, err := session(r)
+	if err != nil {
+		return err
+	}
+	if sess == nil {
+		return &config.APIError{Code: 403, Field: "token"}
+	}
+	name := sess.Username
+	rooms, err := api.Rooms.Chats()
+	if err != nil {
+		return err
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	counts := make([]UnreadCount, 0, len(rooms))
+	for _, cr := range rooms {
+		count := UnreadCount{RoomID: cr.ID, Title: cr.Title}
+		if count.LastRead, count.Unread, err = cr.Messages.Unread(cr.ID, name); err != nil {
+			return err
+		}
+		// Receipts always point at a message, so rooms without one were never read by the user
+		if cr.Type == models.PublicRoom || count.LastRead > 0 {
+			counts = append(counts, count)
+		}
+	}
+	res, _ := json.Marshal(counts)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
+// queryInt parses an optional integer query parameter
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, &config.APIError{Code: 106, Field: name}
+	}
+	return i, nil
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"api_chat/repository"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleSend(t *testing.T) {
+	rooms := repository.NewChatServer()
+	rooms.Init()
+	router := NewRouter(NewAPI(rooms, accounts))
+	cr, _ := rooms.Retrieve("1")
+	if err := rooms.Sanction(cr, models.Mute, "mallory", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name                   string
+		body                   string
+		expectedHTTPStatusCode int
+		expectedCode           int
+	}{
+		{"message", `{"name": "alice", "msg": "hi"}`, 201, 0},
+		{"empty message", `{"name": "alice", "msg": ""}`, 400, 303},
+		{"oversized message", `{"name": "alice", "msg": "` + strings.Repeat("a", models.MaxMessageSize) + `"}`, 400, 303},
+		{"muted user", `{"name": "mallory", "msg": "hi"}`, 403, 112},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			request, _ := http.NewRequest("POST", "/chats/1/messages", strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(writer, request)
+			if writer.Code != tc.expectedHTTPStatusCode {
+				t.Fatalf("Response code is %v: %s", writer.Code, writer.Body.String())
+			}
+			if tc.expectedCode != 0 {
+				var outcome config.Outcome
+				if err := json.Unmarshal(writer.Body.Bytes(), &outcome); err != nil || outcome.Error == nil || outcome.Error.Code != tc.expectedCode {
+					t.Errorf("Expected error %d, got %s", tc.expectedCode, writer.Body.String())
+				}
+				return
+			}
+			var evt models.ChatEvent
+			if err := json.Unmarshal(writer.Body.Bytes(), &evt); err != nil {
+				t.Fatal("Unexpected response", writer.Body.String())
+			}
+			if evt.ID == "" || evt.Timestamp.IsZero() {
+				t.Errorf("Expected the message to be given an ID and a timestamp, got %+v", evt)
+			}
+			if stored, err := cr.Messages.Get(cr.ID, evt.ID); err != nil || stored.Msg != "hi" {
+				t.Errorf("Expected the message to be stored, got %+v (%v)", stored, err)
+			}
+		})
+	}
+}
+
+func TestHandleUnread(t *testing.T) {
+	// A store of its own keeps the rooms of other tests out of the listing
+	rooms := repository.NewChatServer()
+	rooms.Init()
+	router := NewRouter(NewAPI(rooms, accounts))
+	read := &models.ChatRoom{Title: "Read Private Chat", Type: models.PrivateRoom, Password: "123abc123abc"}
+	unread := &models.ChatRoom{Title: "Unread Private Chat", Type: models.PrivateRoom, Password: "123abc123abc"}
+	for _, cr := range []*models.ChatRoom{read, unread} {
+		if err := rooms.Add(cr); err != nil {
+			t.Fatal("Error adding room", err)
+		}
+		if err := cr.Messages.Append(&models.ChatEvent{EventType: models.Broadcast, User: "bob", RoomID: cr.ID, Msg: "hi",
+			ID: "unread-" + cr.Title, Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := read.Messages.MarkRead(read.ID, "test_user", 1); err != nil {
+		t.Fatal(err)
+	}
+	tkn, _ := config.EncodeSessionJWT("test_user", SecretKey)
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/me/unread", nil)
+	request.Header.Set("Authorization", "Bearer "+tkn)
+	router.ServeHTTP(writer, request)
+	if writer.Code != 200 {
+		t.Fatalf("Response code is %v", writer.Code)
+	}
+	var counts []UnreadCount
+	if err := json.Unmarshal(writer.Body.Bytes(), &counts); err != nil {
+		t.Fatal("Unexpected response", writer.Body.String())
+	}
+	listed := make(map[int]bool)
+	for _, count := range counts {
+		listed[count.RoomID] = true
+	}
+	// Public rooms are always listed, private ones once the user read them
+	if !listed[1] || !listed[read.ID] || listed[unread.ID] {
+		t.Errorf("Unexpected rooms listed %+v", counts)
+	}
+}
+
+func TestHandleRevisions(t *testing.T) {
+	rooms := repository.NewChatServer()
+	rooms.Init()
+	router := NewRouter(NewAPI(rooms, accounts))
+	cr, _ := rooms.Retrieve("1")
+	if err := cr.Messages.Append(&models.ChatEvent{EventType: models.Broadcast, User: "bob", RoomID: cr.ID, Msg: "helo",
+		ID: "revised", Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cr.Messages.Edit(cr.ID, "revised", "hello", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		id                     string
+		expectedRevisions      int
+		expectedHTTPStatusCode int
+	}{
+		{"revised", 1, 200},
+		{"missing", 0, 404},
+	}
+	for _, tc := range cases {
+		t.Run(tc.id, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			request, _ := http.NewRequest("GET", "/chats/1/messages/"+tc.id+"/revisions", nil)
+			router.ServeHTTP(writer, request)
+			if writer.Code != tc.expectedHTTPStatusCode {
+				t.Fatalf("Response code is %v", writer.Code)
+			}
+			if tc.expectedHTTPStatusCode != 200 {
+				return
+			}
+			var revisions []models.Revision
+			if err := json.Unmarshal(writer.Body.Bytes(), &revisions); err != nil {
+				t.Fatal("Unexpected response", writer.Body.String())
+			}
+			if len(revisions) != tc.expectedRevisions || revisions[0].Msg != "helo" {
+				t.Errorf("Unexpected revisions %+v", revisions)
+			}
+		})
+	}
+}
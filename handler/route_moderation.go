@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// moderation is the body of a moderation request.
+// Duration is in seconds, bans and mutes without one last until they are lifted. Kicks ignore it.
+type moderation struct {
+	Action   string `json:"action"`
+	Username string `json:"username"`
+	Duration int64  `json:"duration,omitempty"`
+}
+
+// HandleModerate kicks, bans or mutes a user of a room
+// POST /chats/{titleOrID}/moderation
+func (api *API) HandleModerate(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	cr, err := api.Rooms.Retrieve(mux.Vars(r)["titleOrID"])
+	if err != nil {
+		config.Info("erroneous moderation API request", r, err)
+		return err
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		config.Danger("Error reading", r, err.Error())
+		return err
+	}
+	var m moderation
+	if err = json.Unmarshal(body, &m); err != nil {
+		return &config.APIError{Code: 103}
+	}
+	if m.Duration < 0 {
+		return &config.APIError{Code: 105, Field: "duration"}
+	}
+	if !features.CanModerate(cr, identity(r), m.Username) {
+		return &config.APIError{Code: 104, Field: "username"}
+	}
+	var until time.Time
+	if m.Duration > 0 {
+		until = time.Now().Add(time.Duration(m.Duration) * time.Second)
+	}
+	switch m.Action = strings.ToLower(m.Action); m.Action {
+	case models.Kick:
+		if err = features.Kick(cr, m.Username); err != nil {
+			return err
+		}
+	case models.Ban:
+		if err = api.Rooms.Sanction(cr, models.Ban, m.Username, until); err != nil {
+			return err
+		}
+		features.Banish(cr, m.Username, until)
+	case models.Mute:
+		if err = api.Rooms.Sanction(cr, models.Mute, m.Username, until); err != nil {
+			return err
+		}
+		features.Silence(cr, m.Username, until)
+	default:
+		return &config.APIError{Code: 105, Field: "action"}
+	}
+	config.Info(identity(r), "applied", m.Action, "to", m.Username, "in chat room:", cr.Title)
+	config.ReportStatus(w, true, nil)
+	return
+}
+
+// HandleLift lifts a ban or mute of a user of a room
+// DELETE /chats/{titleOrID}/moderation/{action}/{username}
+func (api *API) HandleLift(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	cr, err := api.Rooms.Retrieve(vars["titleOrID"])
+	if err != nil {
+		config.Info("erroneous moderation API request", r, err)
+		return err
+	}
+	if !features.CanModerate(cr, identity(r), vars["username"]) {
+		return &config.APIError{Code: 104, Field: "username"}
+	}
+	action := strings.ToLower(vars["action"])
+	if err = api.Rooms.Lift(cr, action, vars["username"]); err != nil {
+		return err
+	}
+	features.Pardon(cr, action, vars["username"])
+	config.Info(identity(r), "lifted", action, "of", vars["username"], "in chat room:", cr.Title)
+	config.ReportStatus(w, true, nil)
+	return
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// credentials is the body of registration and login requests
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// HandleRegister creates a user account
+// POST /users
+func (api *API) HandleRegister(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	cred, err := readCredentials(r)
+	if err != nil {
+		return err
+	}
+	a := &models.Account{Username: cred.Username, Password: cred.Password}
+	if err = api.Accounts.Register(a); err != nil {
+		config.Info("erroneous users API request", r, err)
+		return err
+	}
+	config.Info("registered user:", a.Username)
+	a.Password = ""
+	res, _ := json.Marshal(a)
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write(res); err != nil {
+		config.Danger("Error writing", res)
+	}
+	return
+}
+
+// HandleSession logs a registered user in, returning a token that identifies them in every room
+// POST /sessions
+func (api *API) HandleSession(w http.ResponseWriter, r *http.Request) (err error) {
+	w.Header().Set("Content-Type", "application/json")
+	cred, err := readCredentials(r)
+	if err != nil {
+		return err
+	}
+	a, err := api.Accounts.Retrieve(cred.Username)
+	// Do not tell unknown users apart from wrong passwords
+	if err != nil || !features.MatchesAccountPassword(cred.Password, a) {
+		return &config.APIError{
+			Code:  304,
+			Field: "password",
+		}
+	}
+	tokenString, err := config.EncodeSessionJWT(a.Username, SecretKey)
+	if err != nil {
+		return err
+	}
+	jsonEncoding, _ := json.Marshal(struct {
+		Outcome  bool   `json:"status"`
+		Username string `json:"name"`
+		Token    string `json:"token"`
+	}{
+		Outcome:  true,
+		Username: a.Username,
+		Token:    tokenString,
+	})
+	w.WriteHeader(http.StatusCreated)
+	if _, err := w.Write(jsonEncoding); err != nil {
+		config.Danger("Error writing", jsonEncoding)
+	}
+	return
+}
+
+func readCredentials(r *http.Request) (cred credentials, err error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		config.Danger("Error reading", r, err.Error())
+		return
+	}
+	if err = json.Unmarshal(body, &cred); err != nil {
+		return cred, &config.APIError{Code: 203}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// NewRouter registers all HTTP handlers of h
+func NewRouter(h *API) *mux.Router {
+	api := mux.NewRouter()
+	//REST-API for chat room [JSON]
+	api.Handle("/chats", ErrHandler(h.HandleList)).Methods(http.MethodGet)
+	api.Handle("/chats", ErrHandler(h.HandlePost)).Methods(http.MethodPost)
+	api.Handle("/chats/{titleOrID}", ErrHandler(h.Authorize(h.HandleRoom))).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	// Change the password of a room, invalidating its tokens
+	api.Handle("/chats/{titleOrID}/password", ErrHandler(h.Authorize(h.HandlePassword))).Methods(http.MethodPut)
+	// Roles of registered users in a room
+	api.Handle("/chats/{titleOrID}/roles/{username}", ErrHandler(h.Authorize(h.HandleRole))).Methods(http.MethodPut)
+	// Kicks, bans and mutes
+	api.Handle("/chats/{titleOrID}/moderation", ErrHandler(h.Authorize(h.HandleModerate))).Methods(http.MethodPost)
+	api.Handle("/chats/{titleOrID}/moderation/{action}/{username}", ErrHandler(h.Authorize(h.HandleLift))).Methods(http.MethodDelete)
+	// User accounts, independent of rooms
+	api.Handle("/users", ErrHandler(h.HandleRegister)).Methods(http.MethodPost)
+	api.Handle("/sessions", ErrHandler(h.HandleSession)).Methods(http.MethodPost)
+	// Check password matches room
+	api.Handle("/chats/{titleOrID}/token", ErrHandler(h.Login)).Methods(http.MethodPost)
+	// Revoke a token before it expires
+	api.Handle("/chats/{titleOrID}/token", ErrHandler(h.Logout)).Methods(http.MethodDelete)
+	// Check password matches room
+	api.Handle("/chats/{titleOrID}/token/renew", ErrHandler(h.RenewToken)).Methods(http.MethodGet)
+	// Message history, newest first
+	api.Handle("/chats/{titleOrID}/messages", ErrHandler(h.Authorize(h.HandleMessages))).Methods(http.MethodGet)
+	api.Handle("/chats/{titleOrID}/messages", ErrHandler(h.Authorize(h.HandleSend))).Methods(http.MethodPost)
+	// Replies to a message
+	api.Handle("/chats/{titleOrID}/messages/{id}/thread", ErrHandler(h.Authorize(h.HandleThread))).Methods(http.MethodGet)
+	// Previous texts of an edited message
+	api.Handle("/chats/{titleOrID}/messages/{id}/revisions", ErrHandler(h.Authorize(h.HandleRevisions))).Methods(http.MethodGet)
+	// Attachments shared in a room
+	api.Handle("/chats/{titleOrID}/attachments", ErrHandler(h.Authorize(h.HandleUpload))).Methods(http.MethodPost)
+	api.Handle("/chats/{titleOrID}/attachments/{id}", ErrHandler(h.Authorize(h.HandleDownload))).Methods(http.MethodGet)
+	// Unread messages of a user across rooms
+	api.Handle("/me/unread", ErrHandler(h.HandleUnread)).Methods(http.MethodGet)
+	// Chat Sessions (WebSocket)
+	// Do not authorize since you can't add headers to WebSockets. We will do authorization when actually receiving chat messages
+	api.Handle("/chats/{titleOrID}/ws", h.Authorize(h.WebSocketHandler)).Methods(http.MethodGet)
+	// Chat Sessions (Server-Sent Events) for clients behind proxies that break WebSockets
+	api.Handle("/chats/{titleOrID}/events", ErrHandler(h.Authorize(h.EventStreamHandler))).Methods(http.MethodGet)
+	return api
+}
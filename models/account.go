@@ -0,0 +1,13 @@
+package models
+
+import (
+	"time"
+)
+
+// Account is a registered user. Its username is reserved: nobody else can chat under it.
+type Account struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Password  string    `json:"password,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+// Attachment is a file uploaded to a ChatRoom, referenced by ChatEvents through its ID
+type Attachment struct {
+	ID          string    `json:"id"`
+	RoomID      int       `json:"room_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AttachmentStore keeps the attachments uploaded to ChatRooms
+type AttachmentStore interface {
+	// Add stores a new attachment with the content read from r and sets its Size
+	Add(a *Attachment, r io.Reader) error
+	// Get returns the attachment of a room by ID
+	Get(roomID int, id string) (Attachment, error)
+	// Open returns the attachment of a room by ID along with its content. The caller must close it.
+	Open(roomID int, id string) (Attachment, io.ReadCloser, error)
+	// Purge removes the attachments of a room
+	Purge(roomID int) error
+}
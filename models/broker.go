@@ -1,20 +1,21 @@
 package models
 
 import (
+	"api_chat/pubsub"
+	"encoding/json"
 	"log"
-	"time"
-)
+	"strings"
 
-// the amount of time to wait when pushing a message to
-// a slow client or a client that closed after `range Clients` started.
-const patience time.Duration = time.Second * 1
+	"github.com/gorilla/websocket"
+)
 
 // Broker maintains the client connections and handles events using a listener goroutine
 type Broker struct {
 	// Registered Clients.
 	Clients map[*Client]bool
 
-	// Inbound messages from the Clients.
+	// Inbound messages from the Clients. They are published to the Bus and delivered
+	// to Clients on every server instance.
 	Notification chan []byte
 
 	// Register requests from the Clients.
@@ -23,20 +24,71 @@ type Broker struct {
 	// Unregister requests from Clients.
 	CloseClient chan *Client
 
+	// Events addressed to a subset of the Clients connected to this server instance.
+	Direct chan Envelope
+
+	// Bus the Notifications are published to. Defaults to an in-process bus.
+	Bus pubsub.Bus
+
 	RoomID int
 }
 
+// Envelope is an event that is only delivered to the Clients it matches
+type Envelope struct {
+	Data  []byte
+	Match func(*Client) bool
+}
+
+// frame is what Brokers publish to the Bus. Every instance matches its own Clients against the
+// recipients of a frame, so users are reached whichever instance they are connected to.
+type frame struct {
+	Data []byte `json:"data,omitempty"`
+	// Users the frame is for, ignoring case. Empty means everybody.
+	To []string `json:"to,omitempty"`
+	// User the frame is not for, ignoring case.
+	Except string `json:"except,omitempty"`
+	// Close code the connections of the recipients are closed with, instead of being sent Data.
+	Close int    `json:"close,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// matches reports whether the frame is for c. Clients are matched by the name they joined with
+// or the name their token was issued for, which is all event stream clients have.
+func (f *frame) matches(c *Client) bool {
+	if f.Except != "" && strings.EqualFold(c.Username, f.Except) {
+		return false
+	}
+	if len(f.To) == 0 {
+		return true
+	}
+	for _, name := range f.To {
+		if strings.EqualFold(c.Username, name) || (c.Identity != "" && strings.EqualFold(c.Identity, name)) {
+			return true
+		}
+	}
+	return false
+}
+
 func NewBroker(ID int) *Broker {
 	return &Broker{
 		Notification: make(chan []byte),
 		OpenClient:   make(chan *Client),
 		CloseClient:  make(chan *Client),
+		Direct:       make(chan Envelope),
 		Clients:      make(map[*Client]bool),
+		Bus:          pubsub.NewLocal(),
 		RoomID:       ID,
 	}
 }
 
 func (br *Broker) Listen() {
+	sub, err := br.Bus.Subscribe(br.RoomID)
+	if err != nil {
+		log.Printf("Error subscribing room %d to bus: %s", br.RoomID, err.Error())
+		return
+	}
+	defer sub.Close()
+	go br.publish()
 	for {
 		select {
 		case c := <-br.OpenClient:
@@ -49,7 +101,7 @@ func (br *Broker) Listen() {
 			// stop sending them messages.
 			if _, ok := br.Clients[c]; ok {
 				delete(br.Clients, c)
-				close(c.Send)
+				c.Outbox.Close()
 				//cr, _ := CS.Retrieve(strconv.Itoa(br.RoomID))
 				//c.unsubscribe(&ChatEvent{User: c.Username})
 				/*if err := cr.RemoveClient(c.Username); err != nil {
@@ -57,20 +109,84 @@ func (br *Broker) Listen() {
 				}*/
 				log.Printf("Removed client. %d registered Clients", len(br.Clients))
 			}
-		case evt := <-br.Notification:
-			// We got a new event from the outside
-			// Send event to all connected Clients
+		case data := <-sub.Channel():
+			// We got a new event from the bus
+			// Send event to the connected Clients it is for
+			var f frame
+			if err := json.Unmarshal(data, &f); err != nil {
+				log.Printf("Error decoding event of room %d: %s", br.RoomID, err.Error())
+				continue
+			}
+			br.deliver(&f)
+		case env := <-br.Direct:
 			for client := range br.Clients {
-				select {
-				case client.Send <- evt:
-				case <-time.After(patience):
-					log.Print("Skipping client: " + client.Username)
-				default:
-					log.Print("Deleting client: " + client.Username)
-					close(client.Send)
-					delete(br.Clients, client)
+				if env.Match(client) {
+					br.send(client, env.Data)
 				}
 			}
 		}
 	}
 }
+
+// SendTo delivers data only to the Clients of the named users, ignoring case, on every server instance.
+func (br *Broker) SendTo(data []byte, usernames ...string) {
+	br.broadcast(&frame{Data: data, To: usernames})
+}
+
+// DisconnectUsers closes the connections of the named users, ignoring case, with a WebSocket close code
+// on every server instance.
+func (br *Broker) DisconnectUsers(code int, text string, usernames ...string) {
+	br.broadcast(&frame{Close: code, Text: text, To: usernames})
+}
+
+// DisconnectAll closes the connections of all Clients with a WebSocket close code on every server instance.
+func (br *Broker) DisconnectAll(code int, text string) {
+	br.broadcast(&frame{Close: code, Text: text})
+}
+
+// SendExcept delivers data to all Clients but those of the sender on every server instance.
+func (br *Broker) SendExcept(data []byte, sender *Client) {
+	br.broadcast(&frame{Data: data, Except: sender.Username})
+}
+
+// publish forwards the Notifications to the bus
+func (br *Broker) publish() {
+	for evt := range br.Notification {
+		br.broadcast(&frame{Data: evt})
+	}
+}
+
+// broadcast publishes f to the Brokers of the room on every server instance
+func (br *Broker) broadcast(f *frame) {
+	data, err := json.Marshal(f)
+	if err == nil {
+		err = br.Bus.Publish(br.RoomID, data)
+	}
+	if err != nil {
+		log.Printf("Error publishing to room %d: %s", br.RoomID, err.Error())
+	}
+}
+
+// deliver sends the data of f to the Clients it is for, or closes their connections
+func (br *Broker) deliver(f *frame) {
+	for client := range br.Clients {
+		if !f.matches(client) {
+			continue
+		}
+		if f.Close != 0 {
+			delete(br.Clients, client)
+			client.Outbox.CloseWith(f.Close, f.Text)
+		} else {
+			br.send(client, f.Data)
+		}
+	}
+}
+
+// send queues evt for client without blocking. Clients overflowing under the Disconnect policy are removed.
+func (br *Broker) send(client *Client, evt []byte) {
+	if !client.Outbox.Push(evt) {
+		log.Print("Disconnecting slow client: " + client.Username)
+		delete(br.Clients, client)
+		client.Outbox.CloseWith(websocket.CloseTryAgainLater, "outbound queue overflow")
+	}
+}
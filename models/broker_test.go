@@ -0,0 +1,143 @@
+package models
+
+import (
+	"api_chat/pubsub"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestBrokerSendTo(t *testing.T) {
+	br := NewBroker(1)
+	go br.Listen()
+	alice := &Client{Username: "Alice", Outbox: NewOutbox(2, DropOldest)}
+	bob := &Client{Username: "bob", Outbox: NewOutbox(2, DropOldest)}
+	br.OpenClient <- alice
+	br.OpenClient <- bob
+	br.SendTo([]byte("psst"), "alice")
+	select {
+	case <-alice.Outbox.Ready():
+		if msgs := alice.Outbox.Drain(); len(msgs) != 1 || string(msgs[0]) != "psst" {
+			t.Errorf("Unexpected messages %q", msgs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Recipient did not receive the message")
+	}
+	select {
+	case <-bob.Outbox.Ready():
+		t.Errorf("Unexpected message %q", bob.Outbox.Drain())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerDisconnectUsers(t *testing.T) {
+	br := NewBroker(1)
+	go br.Listen()
+	alice := &Client{Username: "Alice", Outbox: NewOutbox(2, DropOldest)}
+	bob := &Client{Username: "bob", Outbox: NewOutbox(2, DropOldest)}
+	br.OpenClient <- alice
+	br.OpenClient <- bob
+	br.DisconnectUsers(CloseKicked, "kicked", "ALICE")
+	select {
+	case <-alice.Outbox.Done():
+		if code, text := alice.Outbox.CloseReason(); code != CloseKicked || text != "kicked" {
+			t.Errorf("Unexpected close reason %d %q", code, text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Client was not disconnected")
+	}
+	select {
+	case <-bob.Outbox.Done():
+		t.Error("Unexpected disconnection")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerDisconnectUsersByIdentity(t *testing.T) {
+	br := NewBroker(1)
+	go br.Listen()
+	// Event stream clients only have the name of their token
+	stream := &Client{Identity: "Alice", Outbox: NewOutbox(2, DropOldest)}
+	anonymous := &Client{Outbox: NewOutbox(2, DropOldest)}
+	br.OpenClient <- stream
+	br.OpenClient <- anonymous
+	br.DisconnectUsers(CloseBanned, "banned", "alice")
+	select {
+	case <-stream.Outbox.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Client was not disconnected")
+	}
+	select {
+	case <-anonymous.Outbox.Done():
+		t.Error("Unexpected disconnection")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBrokerAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// Two brokers of the same room standing in for two server instances
+	brokers := make([]*Broker, 2)
+	for i := range brokers {
+		bus, err := pubsub.NewRedis(mr.Addr())
+		if err != nil {
+			t.Fatal("Error connecting to Redis", err)
+		}
+		defer bus.Close()
+		brokers[i] = NewBroker(1)
+		brokers[i].Bus = bus
+		go brokers[i].Listen()
+	}
+	alice := &Client{Username: "alice", Outbox: NewOutbox(2, DropOldest)}
+	bob := &Client{Username: "Bob", Outbox: NewOutbox(2, DropOldest)}
+	carol := &Client{Username: "carol", Outbox: NewOutbox(2, DropOldest)}
+	brokers[0].OpenClient <- alice
+	brokers[1].OpenClient <- bob
+	brokers[1].OpenClient <- carol
+	// Let the brokers subscribe before publishing
+	time.Sleep(50 * time.Millisecond)
+
+	brokers[0].SendTo([]byte("psst"), "bob")
+	expectMessages(t, bob, "psst")
+	brokers[0].SendExcept([]byte("typing"), alice)
+	expectMessages(t, bob, "typing")
+	expectMessages(t, carol, "typing")
+	select {
+	case <-alice.Outbox.Ready():
+		t.Errorf("Unexpected messages %q", alice.Outbox.Drain())
+	case <-time.After(50 * time.Millisecond):
+	}
+	brokers[0].DisconnectUsers(CloseKicked, "kicked", "BOB")
+	select {
+	case <-bob.Outbox.Done():
+		if code, _ := bob.Outbox.CloseReason(); code != CloseKicked {
+			t.Errorf("Unexpected close code %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Client on the other instance was not disconnected")
+	}
+	select {
+	case <-carol.Outbox.Done():
+		t.Error("Unexpected disconnection")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectMessages(t *testing.T, c *Client, want ...string) {
+	t.Helper()
+	select {
+	case <-c.Outbox.Ready():
+		msgs := c.Outbox.Drain()
+		if len(msgs) != len(want) {
+			t.Fatalf("Expected %q, got %q", want, msgs)
+		}
+		for i := range want {
+			if string(msgs[i]) != want[i] {
+				t.Errorf("Expected %q, got %q", want, msgs)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s did not receive %q", c.Username, want)
+	}
+}
@@ -11,6 +11,36 @@ const (
 	Broadcast = "send"
 	// Unsubscribe is used to broadcast a message indicating user has left ChatRoom
 	Unsubscribe = "leave"
+	// Edit is used to change the text of a sent message, referenced by TargetID
+	Edit = "edit"
+	// Delete is used to retract a sent message, referenced by TargetID
+	Delete = "delete"
+	// React is used to attach an Emoji to a sent message, referenced by TargetID
+	React = "react"
+	// Unreact is used to remove an Emoji from a sent message, referenced by TargetID
+	Unreact = "unreact"
+	// DirectMessage is used to send a private message to the users listed in Recipients
+	DirectMessage = "dm"
+	// Mention is used to notify a user of a message addressing them, referenced by TargetID
+	Mention = "mention"
+	// Typing is used to indicate a user is composing a message. It is relayed to the other users but never stored.
+	Typing = "typing"
+	// StoppedTyping is used to indicate a user stopped composing without sending a message
+	StoppedTyping = "stopped_typing"
+	// Receipt is used to acknowledge all messages up to ReadSeq as read
+	Receipt = "receipt"
+	// PresenceChange is used to announce a user's Presence changed
+	PresenceChange = "presence"
+	// Kick is used to announce a moderator removed a user from the room. They may join again.
+	Kick = "kick"
+	// Ban is used to announce a moderator removed a user from the room and keeps them out until the time given by Until
+	Ban = "ban"
+	// Unban is used to announce a banned user may join the room again
+	Unban = "unban"
+	// Mute is used to announce a moderator silenced a user until the time given by Until
+	Mute = "mute"
+	// Unmute is used to announce a muted user may send messages again
+	Unmute = "unmute"
 )
 
 // ChatEvent represents a message event in an associated ChatRoom
@@ -22,4 +52,40 @@ type ChatEvent struct {
 	Msg       string    `json:"msg,omitempty"`
 	Password  string    `json:"secret,omitempty"`
 	Timestamp time.Time `json:"time,omitempty"`
+	// Position of a stored message in the history of its room
+	Seq int `json:"seq,omitempty"`
+	// Assigned by the server, sorts in order of creation
+	ID string `json:"id,omitempty"`
+	// Chosen by the sending client and echoed back to it
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Message an edit, deletion or reaction applies to
+	TargetID string     `json:"target_id,omitempty"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Deleted messages are kept as tombstones without content
+	Deleted bool   `json:"deleted,omitempty"`
+	Emoji   string `json:"emoji,omitempty"`
+	// Users who reacted to a stored message, by emoji
+	Reactions map[string][]string `json:"reactions,omitempty"`
+	// Message that started the thread of a reply
+	ParentID    string     `json:"parent_id,omitempty"`
+	ReplyCount  int        `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+	// Recipients of a direct message
+	Recipients []string `json:"to,omitempty"`
+	// Users addressed with @username in Msg
+	Mentions []string `json:"mentions,omitempty"`
+	// Highest sequence number read by the user of a receipt, and the number of messages left unread
+	ReadSeq  int    `json:"read_seq,omitempty"`
+	Unread   int    `json:"unread,omitempty"`
+	Presence string `json:"presence,omitempty"`
+	// IDs of the files a message shares
+	Attachments []string `json:"attachments,omitempty"`
+	// End of a ban or mute, which lasts until lifted without one
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Revision is a previous text of an edited message
+type Revision struct {
+	Msg      string    `json:"msg"`
+	EditedAt time.Time `json:"edited_at"`
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,8 +15,18 @@ const (
 	HiddenRoom = "hidden"
 )
 
+const (
+	// Owner created the room and may change or delete it, and grant roles
+	Owner = "owner"
+	// Moderator may delete the messages of others
+	Moderator = "moderator"
+	// Member may take part in the conversation. Users without a role are members.
+	Member = "member"
+	// ReadOnly may follow the conversation without taking part in it
+	ReadOnly = "read-only"
+)
+
 // ChatRoom is a struct representing a chat room
-// TODO:  Add Administrator
 type ChatRoom struct {
 	Title       string             `json:"title"`
 	Description string             `json:"description,omitempty"`
@@ -25,4 +37,89 @@ type ChatRoom struct {
 	ID          int                `json:"id"`
 	Broker      *Broker            `json:"-"`
 	Clients     map[string]*Client `json:"-"`
+	Messages    MessageStore       `json:"-"`
+	// Conversations keeps the direct messages between users of the room
+	Conversations ConversationStore `json:"-"`
+	// Attachments keeps the files uploaded to the room
+	Attachments AttachmentStore `json:"-"`
+	// Owner is the registered user who created the room. Rooms created anonymously have none.
+	Owner string `json:"owner,omitempty"`
+	// Roles, Banned and Muted change while the room is in use:
+	// use GrantedRole, GrantedRoles, Grant, SanctionOf and Sanction once it is.
+	// Roles maps the lowercase names of registered users to the role they were granted
+	Roles map[string]string `json:"roles,omitempty"`
+	// Banned maps the lowercase names of banned users to the end of their ban, zero if it lasts until lifted
+	Banned map[string]time.Time `json:"-"`
+	// Muted maps the lowercase names of muted users to the end of their mute, zero if it lasts until lifted
+	Muted map[string]time.Time `json:"-"`
+}
+
+// accessMu guards the Roles, Banned and Muted maps of chat rooms. Rooms are passed around by value,
+// sharing their maps, so the lock is kept here rather than in each room.
+var accessMu sync.RWMutex
+
+// GrantedRole returns the role granted to a user of cr, ignoring case
+func (cr *ChatRoom) GrantedRole(username string) (role string, ok bool) {
+	accessMu.RLock()
+	defer accessMu.RUnlock()
+	role, ok = cr.Roles[strings.ToLower(username)]
+	return
+}
+
+// GrantedRoles returns a copy of the roles granted in cr
+func (cr *ChatRoom) GrantedRoles() map[string]string {
+	accessMu.RLock()
+	defer accessMu.RUnlock()
+	if cr.Roles == nil {
+		return nil
+	}
+	roles := make(map[string]string, len(cr.Roles))
+	for name, role := range cr.Roles {
+		roles[name] = role
+	}
+	return roles
+}
+
+// Grant records the role of a user of cr. Members are not listed.
+func (cr *ChatRoom) Grant(username string, role string) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	if role == Member {
+		delete(cr.Roles, strings.ToLower(username))
+		return
+	}
+	if cr.Roles == nil {
+		cr.Roles = make(map[string]string)
+	}
+	cr.Roles[strings.ToLower(username)] = role
+}
+
+// SanctionOf returns the end of the ban or mute of a user of cr, ignoring case, zero if it lasts until lifted
+func (cr *ChatRoom) SanctionOf(kind string, username string) (until time.Time, ok bool) {
+	accessMu.RLock()
+	defer accessMu.RUnlock()
+	if kind == Mute {
+		until, ok = cr.Muted[strings.ToLower(username)]
+	} else {
+		until, ok = cr.Banned[strings.ToLower(username)]
+	}
+	return
+}
+
+// Sanction bans or mutes a user of cr until the given time, or until lifted if it is zero. A nil until lifts the sanction.
+func (cr *ChatRoom) Sanction(kind string, username string, until *time.Time) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	sanctions := &cr.Banned
+	if kind == Mute {
+		sanctions = &cr.Muted
+	}
+	if until == nil {
+		delete(*sanctions, strings.ToLower(username))
+		return
+	}
+	if *sanctions == nil {
+		*sanctions = make(map[string]time.Time)
+	}
+	(*sanctions)[strings.ToLower(username)] = *until
 }
@@ -0,0 +1,11 @@
+package models
+
+// ConversationStore keeps the direct messages exchanged between users of ChatRooms, apart from the room history
+type ConversationStore interface {
+	// Append stores a direct message from its sender to its Recipients
+	Append(evt *ChatEvent) error
+	// Recent returns up to n of the latest direct messages of a room sent or received by user, oldest first
+	Recent(roomID int, user string, n int) ([]ChatEvent, error)
+	// Purge removes the direct messages of a room
+	Purge(roomID int) error
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// MessageStore keeps the history of ChatEvents broadcast in ChatRooms
+type MessageStore interface {
+	// Append stores evt and assigns it the next sequence number of its room
+	Append(evt *ChatEvent) error
+	// Recent returns up to n of the latest events of a room, oldest first
+	Recent(roomID int, n int) ([]ChatEvent, error)
+	// Before returns up to limit events of a room with a sequence number lower than before, newest first.
+	// A before value <= 0 starts at the latest event.
+	Before(roomID int, before int, limit int) ([]ChatEvent, error)
+	// Since returns up to limit events of a room with a sequence number higher than after, oldest first
+	Since(roomID int, after int, limit int) ([]ChatEvent, error)
+	// Thread returns the replies to a stored message, oldest first
+	Thread(roomID int, id string) ([]ChatEvent, error)
+	// Get returns a stored message of a room by ID
+	Get(roomID int, id string) (ChatEvent, error)
+	// Edit replaces the text of a stored message, keeping the previous one as a Revision
+	Edit(roomID int, id string, msg string, at time.Time) (ChatEvent, error)
+	// Delete turns a stored message into a tombstone, dropping its text, mentions, attachments, reactions and revisions
+	Delete(roomID int, id string, at time.Time) (ChatEvent, error)
+	// Revisions returns the previous texts of a message, oldest first
+	Revisions(roomID int, id string) ([]Revision, error)
+	// React attaches an emoji of a user to a stored message. Reacting twice with the same emoji has no effect.
+	React(roomID int, id string, emoji string, user string) error
+	// Unreact removes an emoji of a user from a stored message
+	Unreact(roomID int, id string, emoji string, user string) error
+	// MarkRead records that user read the messages of a room up to seq. Receipts never move backwards,
+	// nor past the latest message.
+	MarkRead(roomID int, user string, seq int) error
+	// Unread returns the highest sequence number user read in a room and the number of
+	// messages of others after it, ignoring deleted ones
+	Unread(roomID int, user string) (lastRead int, unread int, err error)
+	// Purge removes the history of a room
+	Purge(roomID int) error
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DropOldest discards the oldest queued message to make room for a new one
+	DropOldest = "drop-oldest"
+	// DropNewest discards new messages while the queue is full
+	DropNewest = "drop-newest"
+	// Disconnect closes the connection of a client whose queue is full
+	Disconnect = "disconnect"
+)
+
+var (
+	// QueueSize is the number of outbound messages buffered per client
+	QueueSize = 256
+	// OverflowPolicy is applied when the outbound queue of a client is full
+	OverflowPolicy = DropOldest
+)
+
+// Outbox is a bounded ring buffer of the outbound messages of a Client.
+// Pushing never blocks, so a slow consumer cannot stall the Broker of its room.
+type Outbox struct {
+	buf    [][]byte
+	head   int
+	size   int
+	policy string
+	// ready holds a token while messages are queued
+	ready chan struct{}
+	done  chan struct{}
+	// closeCode and closeText are sent to the peer once the Outbox is closed
+	closeCode int
+	closeText string
+	closed    bool
+	mu        sync.Mutex
+}
+
+// NewOutbox returns an empty Outbox holding up to capacity messages
+func NewOutbox(capacity int, policy string) *Outbox {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Outbox{
+		buf:    make([][]byte, capacity),
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Push queues msg. It returns false if the queue is full and the Disconnect policy applies,
+// in which case the caller should close the Outbox.
+func (o *Outbox) Push(msg []byte) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return true
+	}
+	if o.size == len(o.buf) {
+		switch o.policy {
+		case DropNewest:
+			return true
+		case Disconnect:
+			return false
+		default:
+			// Overwrite the oldest message
+			o.head = (o.head + 1) % len(o.buf)
+			o.size--
+		}
+	}
+	o.buf[(o.head+o.size)%len(o.buf)] = msg
+	o.size++
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Drain removes and returns all queued messages, oldest first
+func (o *Outbox) Drain() [][]byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msgs := make([][]byte, o.size)
+	for i := range msgs {
+		idx := (o.head + i) % len(o.buf)
+		msgs[i] = o.buf[idx]
+		o.buf[idx] = nil
+	}
+	o.head, o.size = 0, 0
+	return msgs
+}
+
+// Ready receives a value whenever messages have been queued
+func (o *Outbox) Ready() <-chan struct{} {
+	return o.ready
+}
+
+// Done is closed once the Outbox is closed
+func (o *Outbox) Done() <-chan struct{} {
+	return o.done
+}
+
+// Close discards all queued messages and tells the writer to close the connection normally
+func (o *Outbox) Close() {
+	o.CloseWith(websocket.CloseNormalClosure, "")
+}
+
+// CloseWith discards all queued messages and tells the writer to close the connection with the given close code
+func (o *Outbox) CloseWith(code int, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.closeCode, o.closeText = code, text
+	o.buf, o.head, o.size = make([][]byte, 1), 0, 0
+	close(o.done)
+}
+
+// CloseReason returns the close code and text given when the Outbox was closed
+func (o *Outbox) CloseReason() (int, string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closeCode, o.closeText
+}
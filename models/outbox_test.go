@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOutboxOverflow(t *testing.T) {
+	cases := []struct {
+		policy       string
+		expectedOK   bool
+		expectedMsgs []string
+	}{
+		{DropOldest, true, []string{"1", "2", "3"}},
+		{DropNewest, true, []string{"0", "1", "2"}},
+		{Disconnect, false, []string{"0", "1", "2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			o := NewOutbox(3, tc.policy)
+			ok := true
+			for i := 0; i < 4; i++ {
+				ok = o.Push([]byte(fmt.Sprint(i)))
+			}
+			if ok != tc.expectedOK {
+				t.Errorf("Expected overflowing push to return %v", tc.expectedOK)
+			}
+			select {
+			case <-o.Ready():
+			default:
+				t.Fatal("Outbox is not ready")
+			}
+			msgs := o.Drain()
+			if len(msgs) != len(tc.expectedMsgs) {
+				t.Fatalf("Expected %d messages, got %d", len(tc.expectedMsgs), len(msgs))
+			}
+			for i, msg := range msgs {
+				if string(msg) != tc.expectedMsgs[i] {
+					t.Errorf("Expected '%s' at position %d, got '%s'", tc.expectedMsgs[i], i, msg)
+				}
+			}
+			if len(o.Drain()) != 0 {
+				t.Error("Outbox was not emptied")
+			}
+		})
+	}
+}
+
+func TestBrokerSlowClients(t *testing.T) {
+	br := NewBroker(1)
+	go br.Listen()
+	fast := &Client{Username: "fast", Outbox: NewOutbox(2, Disconnect)}
+	slow := &Client{Username: "slow", Outbox: NewOutbox(2, Disconnect)}
+	br.OpenClient <- fast
+	br.OpenClient <- slow
+	for i := 0; i < 3; i++ {
+		br.Notification <- []byte(fmt.Sprint(i))
+		// The fast client keeps up with its queue
+		select {
+		case <-fast.Outbox.Ready():
+			fast.Outbox.Drain()
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+	}
+	select {
+	case <-slow.Outbox.Done():
+		if code, _ := slow.Outbox.CloseReason(); code != websocket.CloseTryAgainLater {
+			t.Errorf("Unexpected close code %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Slow client was not disconnected")
+	}
+	select {
+	case <-fast.Outbox.Done():
+		t.Error("Fast client was disconnected")
+	default:
+	}
+}
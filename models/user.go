@@ -1,6 +1,7 @@
 package models
 
 import (
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,15 +18,80 @@ const (
 	MaxMessageSize = 512
 )
 
+const (
+	// CloseKicked is the WebSocket close code telling a client a moderator removed it from the room. It may join again.
+	CloseKicked = 4001
+	// CloseReauthenticate is the WebSocket close code telling a client its token is no longer valid. It may join again with a new one.
+	CloseReauthenticate = 4002
+	// CloseBanned is the WebSocket close code telling a client it is banned from the room
+	CloseBanned = 4003
+)
+
+const (
+	// Online users are connected and active
+	Online = "online"
+	// Idle users are connected but have not been active for a while
+	Idle = "idle"
+	// Away users are connected but have not been active for a long time
+	Away = "away"
+	// Offline users are disconnected, or their connection stopped answering pings
+	Offline = "offline"
+)
+
 // Client represents a user in a ChatRoom
 type Client struct {
-	Username     string    `json:"username"`
-	Color        string    `json:"color"`
+	Username string `json:"username"`
+	Color    string `json:"color"`
+	// LastActivity, Presence and LastPong change while the client is connected:
+	// use Touch, SwapPresence, Ponged and Activity once it is.
 	LastActivity time.Time `json:"last_activity"`
+	// Presence last announced to the room
+	Presence string `json:"presence"`
+	// Time the connection last answered a ping
+	LastPong time.Time `json:"-"`
+	mu       sync.Mutex
 	// The websocket Connection.
 	Conn *websocket.Conn `json:"-"`
-	// Buffered channel of outbound messages.
-	Send chan []byte `json:"-"`
+	// Bounded queue of outbound messages.
+	Outbox *Outbox `json:"-"`
 	// ChatRoom that client is registered with
 	Room *ChatRoom `json:"-"`
+	// Sequence number of the last event received before reconnecting
+	LastSeq int `json:"-"`
+	// Username authenticated by the token the client connected with. Anonymous clients have none.
+	Identity string `json:"-"`
+}
+
+// SwapPresence records state as the presence last announced for c and returns the previous one
+func (c *Client) SwapPresence(state string) (previous string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous, c.Presence = c.Presence, state
+	return
+}
+
+// Touch records activity of c at t
+func (c *Client) Touch(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.LastActivity = t
+}
+
+// Ponged records that the connection of c answered a ping at t
+func (c *Client) Ponged(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.LastPong = t
+}
+
+// Activity returns the last activity of c and the last time its connection answered a ping
+func (c *Client) Activity() (lastActivity time.Time, lastPong time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.LastActivity, c.LastPong
+}
+
+// NewClient returns a Client of room connected through conn, with an Outbox of QueueSize messages
+func NewClient(room *ChatRoom, conn *websocket.Conn) *Client {
+	return &Client{Room: room, Conn: conn, Outbox: NewOutbox(QueueSize, OverflowPolicy)}
 }
@@ -0,0 +1,16 @@
+// Package pubsub carries room notifications between Brokers, possibly running on different server instances.
+package pubsub
+
+// Bus publishes room notifications to every subscribed Broker
+type Bus interface {
+	// Publish sends data to all subscribers of the room
+	Publish(roomID int, data []byte) error
+	// Subscribe starts receiving the data published to the room
+	Subscribe(roomID int) (Subscription, error)
+}
+
+// Subscription receives the data published to a room until it is closed
+type Subscription interface {
+	Channel() <-chan []byte
+	Close() error
+}
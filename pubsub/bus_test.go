@@ -0,0 +1,77 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestBuses(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cases := []struct {
+		name string
+		// Two buses standing in for two server instances
+		newBuses func(t *testing.T) (Bus, Bus)
+	}{
+		{"local", func(t *testing.T) (Bus, Bus) {
+			bus := NewLocal()
+			return bus, bus
+		}},
+		{"redis", func(t *testing.T) (Bus, Bus) {
+			return newTestRedis(t, mr.Addr()), newTestRedis(t, "redis://"+mr.Addr())
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, second := tc.newBuses(t)
+			sub, err := first.Subscribe(1)
+			if err != nil {
+				t.Fatal("Error subscribing", err)
+			}
+			otherRoom, _ := first.Subscribe(2)
+			defer otherRoom.Close()
+			go func() {
+				if err := second.Publish(1, []byte("hello")); err != nil {
+					t.Error("Error publishing", err)
+				}
+			}()
+			if got := receive(t, sub); string(got) != "hello" {
+				t.Errorf("Expected 'hello', got '%s'", got)
+			}
+			select {
+			case data := <-otherRoom.Channel():
+				t.Errorf("Unexpected event in other room: %s", data)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if err := sub.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// Publishing without subscribers must not block
+			if err := second.Publish(1, []byte("nobody")); err != nil {
+				t.Error("Error publishing", err)
+			}
+		})
+	}
+}
+
+func newTestRedis(t *testing.T, addr string) *Redis {
+	t.Helper()
+	bus, err := NewRedis(addr)
+	if err != nil {
+		t.Fatal("Error connecting to Redis", err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+func receive(t *testing.T, sub Subscription) []byte {
+	t.Helper()
+	select {
+	case data := <-sub.Channel():
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package pubsub
+
+import (
+	"sync"
+)
+
+// Local is the in-process Bus. It only reaches Brokers running in the same process.
+type Local struct {
+	subs map[int]map[*localSubscription]bool
+	mu   sync.RWMutex
+}
+
+type localSubscription struct {
+	ch     chan []byte
+	done   chan struct{}
+	once   sync.Once
+	bus    *Local
+	roomID int
+}
+
+// NewLocal returns an in-process Bus
+func NewLocal() *Local {
+	return &Local{subs: make(map[int]map[*localSubscription]bool)}
+}
+
+// Publish hands data to all subscribers of the room, waiting for each of them to receive it
+func (l *Local) Publish(roomID int, data []byte) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for sub := range l.subs[roomID] {
+		select {
+		case sub.ch <- data:
+		case <-sub.done:
+		}
+	}
+	return nil
+}
+
+// Subscribe starts receiving the data published to the room
+func (l *Local) Subscribe(roomID int) (Subscription, error) {
+	sub := &localSubscription{ch: make(chan []byte), done: make(chan struct{}), bus: l, roomID: roomID}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subs[roomID] == nil {
+		l.subs[roomID] = make(map[*localSubscription]bool)
+	}
+	l.subs[roomID][sub] = true
+	return sub, nil
+}
+
+func (s *localSubscription) Channel() <-chan []byte {
+	return s.ch
+}
+
+func (s *localSubscription) Close() error {
+	// Release pending publishers before waiting for the lock they hold
+	s.once.Do(func() { close(s.done) })
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	delete(s.bus.subs[s.roomID], s)
+	if len(s.bus.subs[s.roomID]) == 0 {
+		delete(s.bus.subs, s.roomID)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// channelPrefix namespaces the Redis channels used for room notifications
+const channelPrefix = "chitchat:room:"
+
+// Redis is a Bus backed by Redis Pub/Sub, delivering notifications to Brokers on every server instance
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at addr, given either as host:port or as a redis:// URL
+func NewRedis(addr string) (*Redis, error) {
+	opts := &redis.Options{Addr: addr}
+	if strings.Contains(addr, "://") {
+		var err error
+		if opts, err = redis.ParseURL(addr); err != nil {
+			return nil, err
+		}
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+// Publish sends data to all subscribers of the room
+func (r *Redis) Publish(roomID int, data []byte) error {
+	return r.client.Publish(context.Background(), channelPrefix+strconv.Itoa(roomID), data).Err()
+}
+
+// Subscribe starts receiving the data published to the room
+func (r *Redis) Subscribe(roomID int) (Subscription, error) {
+	ctx := context.Background()
+	ps := r.client.Subscribe(ctx, channelPrefix+strconv.Itoa(roomID))
+	// Wait for confirmation so nothing published after Subscribe returns is missed
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return nil, err
+	}
+	sub := &redisSubscription{ps: ps, ch: make(chan []byte), done: make(chan struct{})}
+	go sub.forward()
+	return sub, nil
+}
+
+// Close disconnects from Redis
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+type redisSubscription struct {
+	ps   *redis.PubSub
+	ch   chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *redisSubscription) forward() {
+	for msg := range s.ps.Channel() {
+		select {
+		case s.ch <- []byte(msg.Payload):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *redisSubscription) Channel() <-chan []byte {
+	return s.ch
+}
+
+func (s *redisSubscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.ps.Close()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AccountLog is the in-memory AccountStore
+type AccountLog struct {
+	accounts map[string]models.Account
+	index    int
+	mu       sync.RWMutex
+}
+
+// NewAccountLog returns an empty AccountLog
+func NewAccountLog() *AccountLog {
+	return &AccountLog{accounts: make(map[string]models.Account)}
+}
+
+// Register will validate a new account, hash its password and add it to the store
+func (al *AccountLog) Register(a *models.Account) (err error) {
+	if apierr, valid := features.IsValidAccount(*a); !valid {
+		return apierr
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	key := strings.ToLower(a.Username)
+	if _, ok := al.accounts[key]; ok {
+		return &config.APIError{
+			Code:  202,
+			Field: "username",
+		}
+	}
+	if err = prepareAccount(a); err != nil {
+		return
+	}
+	al.index++
+	a.ID = al.index
+	al.accounts[key] = *a
+	return
+}
+
+// Retrieve returns the account of a username, ignoring case
+func (al *AccountLog) Retrieve(username string) (models.Account, error) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	a, ok := al.accounts[strings.ToLower(username)]
+	if !ok {
+		return a, &config.APIError{
+			Code:  201,
+			Field: username,
+		}
+	}
+	return a, nil
+}
+
+// prepareAccount hashes the password of a new account and sets its creation time
+func prepareAccount(a *models.Account) error {
+	pass, err := bcrypt.GenerateFromPassword([]byte(a.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	a.Password = string(pass)
+	a.CreatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"api_chat/models"
+)
+
+// AccountStore maintains the registered user accounts
+type AccountStore interface {
+	// Register will validate a new account, hash its password and add it to the store
+	Register(a *models.Account) error
+	// Retrieve returns the account of a username, ignoring case
+	Retrieve(username string) (models.Account, error)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccountStores(t *testing.T) {
+	sqlStore := openTestStore(t, filepath.Join(t.TempDir(), "chitchat.db"))
+	defer sqlStore.Close()
+	cases := []struct {
+		name  string
+		store AccountStore
+	}{
+		{"memory", NewAccountLog()},
+		{"sqlite", &SQLAccountStore{Db: sqlStore.Db}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &models.Account{Username: "Alice", Password: "correct horse"}
+			if err := tc.store.Register(a); err != nil {
+				t.Fatal(err)
+			}
+			if a.ID == 0 || a.Password == "correct horse" || a.CreatedAt.IsZero() {
+				t.Errorf("Account was not prepared %+v", a)
+			}
+			for _, invalid := range []struct {
+				account      models.Account
+				expectedCode int
+			}{
+				{models.Account{Username: "alice", Password: "battery staple"}, 202},
+				{models.Account{Username: "bob smith", Password: "battery staple"}, 205},
+				{models.Account{Username: "bob", Password: "short"}, 205},
+			} {
+				if err := tc.store.Register(&invalid.account); err == nil || err.(*config.APIError).Code != invalid.expectedCode {
+					t.Errorf("Expected error %d registering %+v, got %v", invalid.expectedCode, invalid.account, err)
+				}
+			}
+			stored, err := tc.store.Retrieve("ALICE")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Username != "Alice" || !features.MatchesAccountPassword("correct horse", stored) || features.MatchesAccountPassword("wrong", stored) {
+				t.Errorf("Unexpected account %+v", stored)
+			}
+			if _, err = tc.store.Retrieve("bob"); err == nil || err.(*config.APIError).Code != 201 {
+				t.Errorf("Expected unknown user not to be found, got %v", err)
+			}
+		})
+	}
+}
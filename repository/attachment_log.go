@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"api_chat/storage"
+	"io"
+	"sync"
+)
+
+// AttachmentLog is the in-memory AttachmentStore. The content of attachments is kept in Blobs.
+type AttachmentLog struct {
+	Blobs       storage.Blobs
+	attachments map[string]models.Attachment
+	mu          sync.RWMutex
+}
+
+// NewAttachmentLog returns an empty AttachmentLog storing content in blobs
+func NewAttachmentLog(blobs storage.Blobs) *AttachmentLog {
+	return &AttachmentLog{Blobs: blobs, attachments: make(map[string]models.Attachment)}
+}
+
+// Add stores a new attachment with the content read from r and sets its Size
+func (al *AttachmentLog) Add(a *models.Attachment, r io.Reader) (err error) {
+	if a.Size, err = al.Blobs.Put(a.ID, r); err != nil {
+		return
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.attachments[a.ID] = *a
+	return
+}
+
+// Get returns the attachment of a room by ID
+func (al *AttachmentLog) Get(roomID int, id string) (models.Attachment, error) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	a, ok := al.attachments[id]
+	if !ok || a.RoomID != roomID {
+		return models.Attachment{}, &config.APIError{Code: 108, Field: id}
+	}
+	return a, nil
+}
+
+// Open returns the attachment of a room by ID along with its content
+func (al *AttachmentLog) Open(roomID int, id string) (models.Attachment, io.ReadCloser, error) {
+	a, err := al.Get(roomID, id)
+	if err != nil {
+		return a, nil, err
+	}
+	content, err := al.Blobs.Open(id)
+	return a, content, err
+}
+
+// Purge removes the attachments of a room
+func (al *AttachmentLog) Purge(roomID int) error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	for id, a := range al.attachments {
+		if a.RoomID != roomID {
+			continue
+		}
+		if err := al.Blobs.Delete(id); err != nil {
+			return err
+		}
+		delete(al.attachments, id)
+	}
+	return nil
+}
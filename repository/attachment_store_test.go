@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"api_chat/models"
+	"api_chat/storage"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttachmentStores(t *testing.T) {
+	sqlStore := openTestStore(t, filepath.Join(t.TempDir(), "chitchat.db"))
+	defer sqlStore.Close()
+	cases := []struct {
+		name  string
+		store models.AttachmentStore
+	}{
+		{"memory", NewAttachmentLog(storage.NewMemory())},
+		{"sqlite", &SQLAttachmentStore{Db: sqlStore.Db, Blobs: storage.NewMemory()}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &models.Attachment{ID: "01H", RoomID: 1, Name: "notes.txt", ContentType: "text/plain; charset=utf-8", CreatedAt: time.Now()}
+			if err := tc.store.Add(a, strings.NewReader("hello")); err != nil {
+				t.Fatal(err)
+			}
+			if a.Size != 5 {
+				t.Errorf("Expected size 5, got %d", a.Size)
+			}
+			stored, content, err := tc.store.Open(1, "01H")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(content)
+			content.Close()
+			if stored.Name != "notes.txt" || stored.Size != 5 || string(data) != "hello" {
+				t.Errorf("Unexpected attachment %+v with content %q", stored, data)
+			}
+			if _, err = tc.store.Get(2, "01H"); err == nil {
+				t.Error("Expected attachment of another room not to be found")
+			}
+			if err = tc.store.Purge(1); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err = tc.store.Open(1, "01H"); err == nil {
+				t.Error("Expected attachment to be purged")
+			}
+		})
+	}
+}
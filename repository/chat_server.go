@@ -4,32 +4,51 @@ import (
 	"api_chat/config"
 	"api_chat/features"
 	"api_chat/models"
+	"api_chat/pubsub"
+	"api_chat/storage"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-// ChatServer maintains all ChatRooms. TODO: This will be replaced by a database soon
+// ChatServer is the in-memory RoomStore. SQLStore uses it as a cache for live rooms.
 type ChatServer struct {
 	RoomsID map[int]*models.ChatRoom
 	Rooms   map[string]*models.ChatRoom // TODO: Remove this duplication once data layer moves to DB
 	Index   *int
+	// Messages keeps the history of all rooms
+	Messages models.MessageStore
+	// Conversations keeps the direct messages of all rooms
+	Conversations models.ConversationStore
+	// Attachments keeps the files uploaded to all rooms
+	Attachments models.AttachmentStore
+	// Bus connects the Brokers of all rooms across server instances
+	Bus pubsub.Bus
+	mu  sync.RWMutex
 }
 
-var index int
-
-// CS is the global ChatServer referencing all chat room objects
-var CS ChatServer = ChatServer{
-	RoomsID: make(map[int]*models.ChatRoom),
-	Rooms:   make(map[string]*models.ChatRoom),
-	Index:   &index,
+// NewChatServer returns an empty in-memory ChatServer
+func NewChatServer() *ChatServer {
+	var index int
+	return &ChatServer{
+		RoomsID:       make(map[int]*models.ChatRoom),
+		Rooms:         make(map[string]*models.ChatRoom),
+		Index:         &index,
+		Messages:      NewMessageLog(),
+		Conversations: NewConversationLog(),
+		Attachments:   NewAttachmentLog(storage.NewMemory()),
+		Bus:           pubsub.NewLocal(),
+	}
 }
 
 // Init will initialize the ChatServer with the default public room.
-func (cs ChatServer) Init() {
-	CS.push(&models.ChatRoom{
+func (cs *ChatServer) Init() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.push(&models.ChatRoom{
 		Title:       "Public Chat",
 		Description: "This is the default chat, available to everyone!",
 		Type:        "public",
@@ -42,14 +61,36 @@ func (cs ChatServer) Init() {
 	})
 }
 
-func (cs ChatServer) push(cr *models.ChatRoom) {
+func (cs *ChatServer) push(cr *models.ChatRoom) {
 	// Update indices, create new session
 	*cs.Index++
 	// TODO: Generate UUIDs?
 	cr.ID = *cs.Index
+	cs.attach(cr)
+}
+
+// attach starts a session for a chat room whose ID has already been assigned
+func (cs *ChatServer) attach(cr *models.ChatRoom) {
+	if cr.ID > *cs.Index {
+		*cs.Index = cr.ID
+	}
 	cr.Clients = make(map[string]*models.Client)
+	// The maps are changed in place from now on, copies of the room share them
+	if cr.Roles == nil {
+		cr.Roles = make(map[string]string)
+	}
+	if cr.Banned == nil {
+		cr.Banned = make(map[string]time.Time)
+	}
+	if cr.Muted == nil {
+		cr.Muted = make(map[string]time.Time)
+	}
+	cr.Messages = cs.Messages
+	cr.Conversations = cs.Conversations
+	cr.Attachments = cs.Attachments
 	cr.Type = strings.ToLower(cr.Type)
 	cr.Broker = models.NewBroker(cr.ID)
+	cr.Broker.Bus = cs.Bus
 	// Start broker for rooms
 	go cr.Broker.Listen()
 	// Push to chat server
@@ -57,25 +98,50 @@ func (cs ChatServer) push(cr *models.ChatRoom) {
 	cs.RoomsID[cr.ID] = cr
 }
 
-func (cs ChatServer) pop(title string, ID int) {
+func (cs *ChatServer) pop(title string, ID int) {
 	delete(cs.Rooms, strings.ToLower(title))
 	delete(cs.RoomsID, ID)
 	*cs.Index--
 }
 
+// purge removes the history, direct messages and attachments of a room.
+// The SQL stores find them through the room, so this runs before the room itself is deleted.
+func (cs *ChatServer) purge(ID int) {
+	if err := cs.Messages.Purge(ID); err != nil {
+		config.Warning("error purging history of room", ID, err.Error())
+	}
+	if err := cs.Conversations.Purge(ID); err != nil {
+		config.Warning("error purging direct messages of room", ID, err.Error())
+	}
+	if err := cs.Attachments.Purge(ID); err != nil {
+		config.Warning("error purging attachments of room", ID, err.Error())
+	}
+}
+
 // Chats will return all non-hidden ChatRooms
-func (cs ChatServer) Chats() (rooms []models.ChatRoom, err error) {
+func (cs *ChatServer) Chats() (rooms []models.ChatRoom, err error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	rooms = make([]models.ChatRoom, 0)
-	for _, v := range CS.Rooms {
+	for _, v := range cs.Rooms {
 		if v.Type != models.HiddenRoom {
-			rooms = append(rooms, *v)
+			room := *v
+			// The roles may change while the copy is in use
+			room.Roles = v.GrantedRoles()
+			rooms = append(rooms, room)
 		}
 	}
 	return
 }
 
 // Retrieve returns a single chat room based on title or ID
-func (cs ChatServer) Retrieve(title string) (cr *models.ChatRoom, err error) {
+func (cs *ChatServer) Retrieve(title string) (cr *models.ChatRoom, err error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.retrieve(title)
+}
+
+func (cs *ChatServer) retrieve(title string) (cr *models.ChatRoom, err error) {
 	if !cs.roomExists(title) {
 		return cr, &config.APIError{
 			Code:  101,
@@ -87,27 +153,27 @@ func (cs ChatServer) Retrieve(title string) (cr *models.ChatRoom, err error) {
 	} else {
 		cr = cs.Rooms[strings.ToLower(title)]
 	}
-	//err = Db.QueryRow("select id, content, author from posts where id = $1", id).Scan(&post.Id, &post.Content, &post.Author)
 	return cr, nil
 }
 
 // RetrieveID returns a single chat room based on ID. NOTE: This has no error handling unlike cs.Retrieve()
-func (cs ChatServer) RetrieveID(ID int) (cr *models.ChatRoom, err error) {
+func (cs *ChatServer) RetrieveID(ID int) (cr *models.ChatRoom, err error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	cr = cs.RoomsID[ID]
-	//err = Db.QueryRow("select id, content, author from posts where id = $1", id).Scan(&post.Id, &post.Content, &post.Author)
 	return
 }
 
-func (cs ChatServer) roomExists(titleorID string) bool {
+func (cs *ChatServer) roomExists(titleorID string) bool {
 	if id, err := strconv.Atoi(titleorID); err == nil {
-		for k := range CS.RoomsID {
+		for k := range cs.RoomsID {
 			if k == id {
 				return true
 			}
 		}
 	} else {
 		titleorID = strings.ToLower(titleorID)
-		for k := range CS.Rooms {
+		for k := range cs.Rooms {
 			if strings.ToLower(k) == titleorID {
 				return true
 			}
@@ -117,61 +183,168 @@ func (cs ChatServer) roomExists(titleorID string) bool {
 }
 
 // Add will create a new chat room and add it to the server
-func (cs ChatServer) Add(cr *models.ChatRoom) (err error) {
+func (cs *ChatServer) Add(cr *models.ChatRoom) (err error) {
 	// validate chat room request
 	if rapier, valid := features.IsValid(*cr); !valid {
 		return rapier
 	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	if cs.roomExists(cr.Title) { // TODO: What if the room is hidden? Return unspecified error or inform user?
 		return &config.APIError{
 			Code:  102,
 			Field: "title",
 		}
 	}
+	if err = prepare(cr); err != nil {
+		return
+	}
+	cs.push(cr)
+	return
+}
+
+// prepare hashes the password of a validated chat room and sets its timestamps
+func prepare(cr *models.ChatRoom) (err error) {
 	cr.Type = strings.ToLower(cr.Type)
 	if cr.Type != models.PublicRoom {
-		pass, err := bcrypt.GenerateFromPassword([]byte(cr.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return &config.APIError{
-				Code:  104,
-				Field: "secret",
-			}
+		if cr.Password, err = hashPassword(cr.Password); err != nil {
+			return
 		}
-		cr.Password = string(pass)
 	} else if cr.Type == models.PublicRoom {
 		cr.Password = ""
 	}
 
+	// Roles are granted once the room exists
+	cr.Roles = nil
 	cr.CreatedAt = time.Now()
 	cr.UpdatedAt = time.Now()
-	cs.push(cr)
 	return
 }
 
+// hashPassword hashes the password of a chat room with bcrypt
+func hashPassword(password string) (string, error) {
+	pass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", &config.APIError{
+			Code:  104,
+			Field: "secret",
+		}
+	}
+	return string(pass), nil
+}
+
 // Update a chat room. NOTE: Authorization should have been done before calling this
-// TODO: Get input from requested ID. Edit both RoomsID and Rooms.
-func (cs ChatServer) Update(titleOrID string, modifiedChatRoom *models.ChatRoom) (err error) {
-	currentChatRoom, err := cs.Retrieve(titleOrID)
+func (cs *ChatServer) Update(titleOrID string, modifiedChatRoom *models.ChatRoom) (err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	currentChatRoom, err := cs.retrieve(titleOrID)
 	if err != nil {
 		return
 	}
+	if err = prepareUpdate(currentChatRoom, modifiedChatRoom); err != nil {
+		return
+	}
+	if other, ok := cs.Rooms[strings.ToLower(modifiedChatRoom.Title)]; ok && other.ID != currentChatRoom.ID {
+		return &config.APIError{
+			Code:  102,
+			Field: "title",
+		}
+	}
+	cs.replace(currentChatRoom, modifiedChatRoom)
+	return
+}
+
+// prepareUpdate validates modifiedChatRoom and copies over the fields that cannot be updated
+func prepareUpdate(currentChatRoom, modifiedChatRoom *models.ChatRoom) error {
 	// Update password for validation
 	modifiedChatRoom.Password = currentChatRoom.Password
 	if apierr, valid := features.IsValid(*modifiedChatRoom); !valid {
 		return apierr
 	}
-	// Update chat room
-	// TODO: Allow updating Password?
+	// Passwords are changed through UpdatePassword
+	modifiedChatRoom.Type = strings.ToLower(modifiedChatRoom.Type)
 	modifiedChatRoom.ID = currentChatRoom.ID
+	modifiedChatRoom.CreatedAt = currentChatRoom.CreatedAt
 	modifiedChatRoom.UpdatedAt = time.Now()
-	*currentChatRoom = *modifiedChatRoom
-	//_, err = Db.Exec("update posts set content = $2, author = $3 where id = $1", post.Id, post.Content, post.Author)
+	return nil
+}
+
+// replace copies the editable fields of modifiedChatRoom to a live chat room and re-indexes its title.
+// Everything else, from its session and stores to its password, owner and sanctions, is kept.
+func (cs *ChatServer) replace(currentChatRoom, modifiedChatRoom *models.ChatRoom) {
+	delete(cs.Rooms, strings.ToLower(currentChatRoom.Title))
+	currentChatRoom.Title = modifiedChatRoom.Title
+	currentChatRoom.Description = modifiedChatRoom.Description
+	currentChatRoom.Type = modifiedChatRoom.Type
+	currentChatRoom.UpdatedAt = modifiedChatRoom.UpdatedAt
+	cs.Rooms[strings.ToLower(currentChatRoom.Title)] = currentChatRoom
+}
+
+// UpdatePassword replaces the password of a private or hidden chat room. NOTE: Authorization should have been done before calling this
+func (cs *ChatServer) UpdatePassword(cr *models.ChatRoom, password string) (err error) {
+	hash, err := preparePassword(cr, password)
+	if err != nil {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cr.Password = hash
+	cr.UpdatedAt = time.Now()
+	return
+}
+
+// preparePassword validates a new password of a chat room and hashes it. Public rooms have no password to change.
+func preparePassword(cr *models.ChatRoom, password string) (string, error) {
+	if strings.ToLower(cr.Type) == models.PublicRoom {
+		return "", &config.APIError{Code: 105, Field: "visibility"}
+	}
+	modifiedChatRoom := *cr
+	modifiedChatRoom.Password = password
+	if apierr, valid := features.IsValid(modifiedChatRoom); !valid {
+		return "", apierr
+	}
+	return hashPassword(password)
+}
+
+// SetRole grants a role to a registered user of a chat room. NOTE: Authorization should have been done before calling this
+func (cs *ChatServer) SetRole(cr *models.ChatRoom, username string, role string) (err error) {
+	if err = features.IsValidRole(cr, username, role); err != nil {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cr.Grant(username, role)
+	return
+}
+
+// Sanction bans or mutes a user of a chat room until the given time, or until lifted if it is zero.
+// NOTE: Authorization should have been done before calling this
+func (cs *ChatServer) Sanction(cr *models.ChatRoom, kind string, username string, until time.Time) (err error) {
+	if err = features.IsValidSanction(kind, until); err != nil {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cr.Sanction(kind, username, &until)
+	return
+}
+
+// Lift ends a ban or mute of a user of a chat room
+func (cs *ChatServer) Lift(cr *models.ChatRoom, kind string, username string) (err error) {
+	if err = features.IsValidSanction(kind, time.Time{}); err != nil {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cr.Sanction(kind, username, nil)
 	return
 }
 
 // Delete a chat room
-func (cs ChatServer) Delete(cr *models.ChatRoom) (err error) {
+func (cs *ChatServer) Delete(cr *models.ChatRoom) (err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.purge(cr.ID)
 	cs.pop(strings.ToLower(cr.Title), cr.ID)
-	//_, err = Db.Exec("delete from posts where id = $1", post.Id)
 	return
 }
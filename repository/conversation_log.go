@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"api_chat/models"
+	"strings"
+	"sync"
+)
+
+// ConversationLog is the in-memory ConversationStore
+type ConversationLog struct {
+	rooms map[int][]models.ChatEvent
+	mu    sync.RWMutex
+}
+
+// NewConversationLog returns an empty ConversationLog
+func NewConversationLog() *ConversationLog {
+	return &ConversationLog{rooms: make(map[int][]models.ChatEvent)}
+}
+
+// Append stores a direct message from its sender to its Recipients
+func (cl *ConversationLog) Append(evt *models.ChatEvent) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	stored := *evt
+	stored.Recipients = append([]string(nil), evt.Recipients...)
+	cl.rooms[evt.RoomID] = append(cl.rooms[evt.RoomID], stored)
+	return nil
+}
+
+// Recent returns up to n of the latest direct messages of a room sent or received by user, oldest first
+func (cl *ConversationLog) Recent(roomID int, user string, n int) ([]models.ChatEvent, error) {
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	history := cl.rooms[roomID]
+	events := make([]models.ChatEvent, 0)
+	for i := len(history) - 1; i >= 0 && len(events) < n; i-- {
+		if participates(history[i], user) {
+			events = append(events, history[i])
+		}
+	}
+	// Flip to chronological order
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// Purge removes the direct messages of a room
+func (cl *ConversationLog) Purge(roomID int) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	delete(cl.rooms, roomID)
+	return nil
+}
+
+// participates reports whether user sent or received evt
+func participates(evt models.ChatEvent, user string) bool {
+	if strings.EqualFold(evt.User, user) {
+		return true
+	}
+	for _, name := range evt.Recipients {
+		if strings.EqualFold(name, user) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"api_chat/models"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConversationStores(t *testing.T) {
+	sqlStore := openTestStore(t, filepath.Join(t.TempDir(), "chitchat.db"))
+	defer sqlStore.Close()
+	cases := []struct {
+		name  string
+		store models.ConversationStore
+	}{
+		{"memory", NewConversationLog()},
+		{"sqlite", &SQLConversationStore{Db: sqlStore.Db}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			messages := []struct {
+				from string
+				to   []string
+			}{
+				{"alice", []string{"bob"}},
+				{"bob", []string{"alice"}},
+				{"carol", []string{"bob", "dave"}},
+				{"alice", []string{"carol"}},
+			}
+			for i, m := range messages {
+				evt := &models.ChatEvent{EventType: models.DirectMessage, User: m.from, Recipients: m.to, RoomID: 1,
+					Msg: fmt.Sprintf("message %d", i), Timestamp: time.Now(), ID: fmt.Sprintf("dm-%d", i)}
+				if err := tc.store.Append(evt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bob, err := tc.store.Recent(1, "Bob", 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bob) != 3 || bob[0].ID != "dm-0" || bob[2].ID != "dm-2" || len(bob[2].Recipients) != 2 || bob[2].Recipients[1] != "dave" {
+				t.Errorf("Unexpected conversations of bob %+v", bob)
+			}
+			if alice, _ := tc.store.Recent(1, "alice", 2); len(alice) != 2 || alice[0].ID != "dm-1" || alice[1].ID != "dm-3" {
+				t.Errorf("Unexpected latest conversations of alice %+v", alice)
+			}
+			if err := tc.store.Purge(1); err != nil {
+				t.Fatal(err)
+			}
+			if purged, _ := tc.store.Recent(1, "bob", 10); len(purged) != 0 {
+				t.Errorf("Expected direct messages to be purged, got %+v", purged)
+			}
+		})
+	}
+}
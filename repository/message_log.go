@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessageLog is the in-memory MessageStore
+type MessageLog struct {
+	rooms map[int][]models.ChatEvent
+	// positions maps message IDs to their index in the history of their room
+	positions map[string]int
+	revisions map[string][]models.Revision
+	// reactions maps message IDs to the users who reacted with each emoji
+	reactions map[string]map[string][]string
+	// replies maps message IDs to the positions of their replies
+	replies map[string][]int
+	// receipts maps rooms to the highest sequence number read by each user, by lower case username
+	receipts map[int]map[string]int
+	mu       sync.RWMutex
+}
+
+// NewMessageLog returns an empty MessageLog
+func NewMessageLog() *MessageLog {
+	return &MessageLog{
+		rooms:     make(map[int][]models.ChatEvent),
+		positions: make(map[string]int),
+		revisions: make(map[string][]models.Revision),
+		reactions: make(map[string]map[string][]string),
+		replies:   make(map[string][]int),
+		receipts:  make(map[int]map[string]int),
+	}
+}
+
+// Append stores evt and assigns it the next sequence number of its room
+func (ml *MessageLog) Append(evt *models.ChatEvent) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	history := ml.rooms[evt.RoomID]
+	evt.Seq = 1
+	if len(history) > 0 {
+		evt.Seq = history[len(history)-1].Seq + 1
+	}
+	if evt.ID != "" {
+		ml.positions[evt.ID] = len(history)
+	}
+	if evt.ParentID != "" {
+		ml.replies[evt.ParentID] = append(ml.replies[evt.ParentID], len(history))
+	}
+	stored := *evt
+	stored.Mentions = append([]string(nil), evt.Mentions...)
+	stored.Attachments = append([]string(nil), evt.Attachments...)
+	ml.rooms[evt.RoomID] = append(history, stored)
+	return nil
+}
+
+// Recent returns up to n of the latest events of a room, oldest first
+func (ml *MessageLog) Recent(roomID int, n int) ([]models.ChatEvent, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	history := ml.rooms[roomID]
+	if n < len(history) {
+		history = history[len(history)-n:]
+	}
+	return ml.annotate(append([]models.ChatEvent(nil), history...)), nil
+}
+
+// Before returns up to limit events of a room with a sequence number lower than before, newest first
+func (ml *MessageLog) Before(roomID int, before int, limit int) ([]models.ChatEvent, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	history := ml.rooms[roomID]
+	events := make([]models.ChatEvent, 0, limit)
+	for i := len(history) - 1; i >= 0 && len(events) < limit; i-- {
+		if before <= 0 || history[i].Seq < before {
+			events = append(events, history[i])
+		}
+	}
+	return ml.annotate(events), nil
+}
+
+// Since returns up to limit events of a room with a sequence number higher than after, oldest first
+func (ml *MessageLog) Since(roomID int, after int, limit int) ([]models.ChatEvent, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	history := ml.rooms[roomID]
+	// Sequence numbers are ascending, so search for the first event after the given one
+	i := sort.Search(len(history), func(i int) bool { return history[i].Seq > after })
+	history = history[i:]
+	if limit < len(history) {
+		history = history[:limit]
+	}
+	return ml.annotate(append([]models.ChatEvent(nil), history...)), nil
+}
+
+// Get returns a stored message of a room by ID
+func (ml *MessageLog) Get(roomID int, id string) (models.ChatEvent, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	evt, err := ml.find(roomID, id)
+	if err != nil {
+		return models.ChatEvent{}, err
+	}
+	return ml.annotate([]models.ChatEvent{*evt})[0], nil
+}
+
+// Edit replaces the text of a stored message, keeping the previous one as a Revision
+func (ml *MessageLog) Edit(roomID int, id string, msg string, at time.Time) (models.ChatEvent, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	evt, err := ml.find(roomID, id)
+	if err != nil {
+		return models.ChatEvent{}, err
+	}
+	if evt.Deleted {
+		return models.ChatEvent{}, &config.APIError{Code: 107, Field: id}
+	}
+	ml.revisions[id] = append(ml.revisions[id], models.Revision{Msg: evt.Msg, EditedAt: at})
+	evt.Msg = msg
+	evt.EditedAt = &at
+	return *evt, nil
+}
+
+// Delete turns a stored message into a tombstone
+func (ml *MessageLog) Delete(roomID int, id string, at time.Time) (models.ChatEvent, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	evt, err := ml.find(roomID, id)
+	if err != nil {
+		return models.ChatEvent{}, err
+	}
+	if evt.Deleted {
+		return models.ChatEvent{}, &config.APIError{Code: 107, Field: id}
+	}
+	evt.Msg = ""
+	evt.Mentions = nil
+	evt.Attachments = nil
+	evt.Deleted = true
+	evt.EditedAt = &at
+	delete(ml.reactions, id)
+	delete(ml.revisions, id)
+	return *evt, nil
+}
+
+// Revisions returns the previous texts of a message, oldest first
+func (ml *MessageLog) Revisions(roomID int, id string) ([]models.Revision, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	if _, err := ml.find(roomID, id); err != nil {
+		return nil, err
+	}
+	return append([]models.Revision(nil), ml.revisions[id]...), nil
+}
+
+// React attaches an emoji of a user to a stored message
+func (ml *MessageLog) React(roomID int, id string, emoji string, user string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	evt, err := ml.find(roomID, id)
+	if err != nil {
+		return err
+	}
+	if evt.Deleted {
+		return &config.APIError{Code: 107, Field: id}
+	}
+	if ml.reactions[id] == nil {
+		ml.reactions[id] = make(map[string][]string)
+	}
+	for _, name := range ml.reactions[id][emoji] {
+		if strings.EqualFold(name, user) {
+			return nil
+		}
+	}
+	ml.reactions[id][emoji] = append(ml.reactions[id][emoji], user)
+	return nil
+}
+
+// Unreact removes an emoji of a user from a stored message
+func (ml *MessageLog) Unreact(roomID int, id string, emoji string, user string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if _, err := ml.find(roomID, id); err != nil {
+		return err
+	}
+	users := ml.reactions[id][emoji]
+	for i, name := range users {
+		if strings.EqualFold(name, user) {
+			users = append(users[:i:i], users[i+1:]...)
+			break
+		}
+	}
+	if len(users) == 0 {
+		delete(ml.reactions[id], emoji)
+	} else {
+		ml.reactions[id][emoji] = users
+	}
+	return nil
+}
+
+// Thread returns the replies to a stored message, oldest first
+func (ml *MessageLog) Thread(roomID int, id string) ([]models.ChatEvent, error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	if _, err := ml.find(roomID, id); err != nil {
+		return nil, err
+	}
+	history := ml.rooms[roomID]
+	replies := make([]models.ChatEvent, 0, len(ml.replies[id]))
+	for _, i := range ml.replies[id] {
+		replies = append(replies, history[i])
+	}
+	return ml.annotate(replies), nil
+}
+
+// MarkRead records that user read the messages of a room up to seq, or up to the latest message if seq is past it
+func (ml *MessageLog) MarkRead(roomID int, user string, seq int) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if history := ml.rooms[roomID]; len(history) == 0 {
+		seq = 0
+	} else if latest := history[len(history)-1].Seq; seq > latest {
+		seq = latest
+	}
+	if ml.receipts[roomID] == nil {
+		ml.receipts[roomID] = make(map[string]int)
+	}
+	if key := strings.ToLower(user); seq > ml.receipts[roomID][key] {
+		ml.receipts[roomID][key] = seq
+	}
+	return nil
+}
+
+// Unread returns the highest sequence number user read in a room and the number of messages of others after it
+func (ml *MessageLog) Unread(roomID int, user string) (lastRead int, unread int, err error) {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	lastRead = ml.receipts[roomID][strings.ToLower(user)]
+	history := ml.rooms[roomID]
+	i := sort.Search(len(history), func(i int) bool { return history[i].Seq > lastRead })
+	for _, evt := range history[i:] {
+		if !evt.Deleted && !strings.EqualFold(evt.User, user) {
+			unread++
+		}
+	}
+	return
+}
+
+// annotate attaches copies of the reactions and the thread summary to events. The caller must hold ml.mu
+func (ml *MessageLog) annotate(events []models.ChatEvent) []models.ChatEvent {
+	for i := range events {
+		if replies := ml.replies[events[i].ID]; len(replies) > 0 {
+			last := ml.rooms[events[i].RoomID][replies[len(replies)-1]].Timestamp
+			events[i].ReplyCount = len(replies)
+			events[i].LastReplyAt = &last
+		}
+		if len(ml.reactions[events[i].ID]) == 0 {
+			continue
+		}
+		events[i].Reactions = make(map[string][]string, len(ml.reactions[events[i].ID]))
+		for emoji, users := range ml.reactions[events[i].ID] {
+			events[i].Reactions[emoji] = append([]string(nil), users...)
+		}
+	}
+	return events
+}
+
+// find returns the stored message. The caller must hold ml.mu
+func (ml *MessageLog) find(roomID int, id string) (*models.ChatEvent, error) {
+	history := ml.rooms[roomID]
+	i, ok := ml.positions[id]
+	if !ok || i >= len(history) || history[i].ID != id {
+		return nil, &config.APIError{Code: 107, Field: id}
+	}
+	return &history[i], nil
+}
+
+// Purge removes the history of a room
+func (ml *MessageLog) Purge(roomID int) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	for _, evt := range ml.rooms[roomID] {
+		delete(ml.positions, evt.ID)
+		delete(ml.revisions, evt.ID)
+		delete(ml.reactions, evt.ID)
+		delete(ml.replies, evt.ID)
+	}
+	delete(ml.rooms, roomID)
+	delete(ml.receipts, roomID)
+	return nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"api_chat/models"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMessageStores(t *testing.T) {
+	sqlStore := openTestStore(t, filepath.Join(t.TempDir(), "chitchat.db"))
+	defer sqlStore.Close()
+	if err := sqlStore.Add(&models.ChatRoom{Title: "second room", Type: "public"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		store models.MessageStore
+	}{
+		{"memory", NewMessageLog()},
+		{"sqlite", &SQLMessageStore{Db: sqlStore.Db}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 1; i <= 5; i++ {
+				for roomID := 1; roomID <= 2; roomID++ {
+					evt := &models.ChatEvent{EventType: models.Broadcast, User: "test_user", RoomID: roomID, Msg: fmt.Sprintf("message %d", i), Timestamp: time.Now(),
+						ID: fmt.Sprintf("%d-%d", roomID, i), ClientMsgID: fmt.Sprintf("local-%d", i)}
+					if err := tc.store.Append(evt); err != nil {
+						t.Fatal("Error appending", err)
+					}
+					if evt.Seq != i {
+						t.Errorf("Expected sequence %d, got %d", i, evt.Seq)
+					}
+				}
+			}
+			recent, err := tc.store.Recent(1, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recent) != 3 || recent[0].Seq != 3 || recent[2].Seq != 5 || recent[2].Msg != "message 5" || recent[2].RoomID != 1 ||
+				recent[2].ID != "1-5" || recent[2].ClientMsgID != "local-5" {
+				t.Errorf("Unexpected recent history %+v", recent)
+			}
+			page, _ := tc.store.Before(1, 0, 2)
+			if len(page) != 2 || page[0].Seq != 5 || page[1].Seq != 4 {
+				t.Fatalf("Unexpected first page %+v", page)
+			}
+			page, _ = tc.store.Before(1, page[1].Seq, 10)
+			if len(page) != 3 || page[0].Seq != 3 || page[2].Seq != 1 {
+				t.Errorf("Unexpected second page %+v", page)
+			}
+			missed, _ := tc.store.Since(1, 2, 2)
+			if len(missed) != 2 || missed[0].Seq != 3 || missed[1].Seq != 4 {
+				t.Errorf("Unexpected missed events %+v", missed)
+			}
+			if all, _ := tc.store.Recent(2, 100); len(all) != 5 {
+				t.Errorf("Expected 5 messages, got %d", len(all))
+			}
+			edited, err := tc.store.Edit(1, "1-4", "message 4, edited", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if edited.Msg != "message 4, edited" || edited.EditedAt == nil || edited.Seq != 4 {
+				t.Errorf("Unexpected edited message %+v", edited)
+			}
+			if _, err = tc.store.Edit(1, "1-4", "message 4, edited twice", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			revisions, err := tc.store.Revisions(1, "1-4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != 2 || revisions[0].Msg != "message 4" || revisions[1].Msg != "message 4, edited" {
+				t.Errorf("Unexpected revisions %+v", revisions)
+			}
+			for _, user := range []string{"alice", "bob", "Alice"} {
+				if err = tc.store.React(1, "1-3", "👍", user); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = tc.store.React(1, "1-4", "🎉", "bob"); err != nil {
+				t.Fatal(err)
+			}
+			if err = tc.store.Unreact(1, "1-4", "🎉", "bob"); err != nil {
+				t.Fatal(err)
+			}
+			recent, _ = tc.store.Recent(1, 3)
+			if users := recent[0].Reactions["👍"]; len(users) != 2 || users[0] != "alice" || users[1] != "bob" {
+				t.Errorf("Unexpected reactions %+v", recent[0].Reactions)
+			}
+			if len(recent[1].Reactions) != 0 {
+				t.Errorf("Expected reaction to be removed, got %+v", recent[1].Reactions)
+			}
+			if err = tc.store.React(1, "1-9", "👍", "alice"); err == nil {
+				t.Error("Expected reacting to a missing message to fail")
+			}
+			if _, err = tc.store.Delete(1, "1-3", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			// Deleted messages stay in the history as tombstones
+			recent, _ = tc.store.Recent(1, 3)
+			if len(recent) != 3 || !recent[0].Deleted || recent[0].Msg != "" || recent[0].Reactions != nil || recent[1].Msg != "message 4, edited twice" {
+				t.Errorf("Unexpected history after edit and delete %+v", recent)
+			}
+			if _, err = tc.store.Edit(1, "1-3", "resurrected", time.Now()); err == nil {
+				t.Error("Expected editing a deleted message to fail")
+			}
+			if _, err = tc.store.Get(2, "1-4"); err == nil {
+				t.Error("Expected message of another room not to be found")
+			}
+			reply := &models.ChatEvent{EventType: models.Broadcast, User: "bob", RoomID: 1, Msg: "reply", Timestamp: time.Now(), ID: "1-6", ParentID: "1-2",
+				Mentions: []string{"test_user"}, Attachments: []string{"01H"}}
+			if err = tc.store.Append(reply); err != nil {
+				t.Fatal(err)
+			}
+			thread, err := tc.store.Thread(1, "1-2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(thread) != 1 || thread[0].ID != "1-6" || thread[0].ParentID != "1-2" || len(thread[0].Mentions) != 1 || thread[0].Mentions[0] != "test_user" ||
+				len(thread[0].Attachments) != 1 || thread[0].Attachments[0] != "01H" {
+				t.Errorf("Unexpected thread %+v", thread)
+			}
+			if parent, _ := tc.store.Get(1, "1-2"); parent.ReplyCount != 1 || parent.LastReplyAt == nil || !parent.LastReplyAt.Equal(reply.Timestamp) {
+				t.Errorf("Unexpected thread summary %+v", parent)
+			}
+			if _, err = tc.store.Thread(2, "1-2"); err == nil {
+				t.Error("Expected thread of another room not to be found")
+			}
+			if lastRead, unread, err := tc.store.Unread(1, "alice"); err != nil || lastRead != 0 || unread != 5 {
+				t.Errorf("Expected 5 unread messages, got %d after %d (%v)", unread, lastRead, err)
+			}
+			for _, receipt := range []struct {
+				user string
+				seq  int
+			}{{"alice", 4}, {"Alice", 2}, {"bob", 4}} {
+				if err = tc.store.MarkRead(1, receipt.user, receipt.seq); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if lastRead, unread, _ := tc.store.Unread(1, "ALICE"); lastRead != 4 || unread != 2 {
+				t.Errorf("Expected 2 unread messages after 4, got %d after %d", unread, lastRead)
+			}
+			// Own messages are never unread
+			if _, unread, _ := tc.store.Unread(1, "bob"); unread != 1 {
+				t.Errorf("Expected 1 unread message, got %d", unread)
+			}
+			// Receipts stop at the latest message, so the messages that follow it are unread
+			latest, _ := tc.store.Recent(1, 1)
+			if err = tc.store.MarkRead(1, "carol", 1000); err != nil {
+				t.Fatal(err)
+			}
+			if lastRead, _, _ := tc.store.Unread(1, "carol"); len(latest) != 1 || lastRead != latest[0].Seq {
+				t.Errorf("Expected receipt to stop at the latest message, got %d", lastRead)
+			}
+			// Tombstones keep nothing of what was said
+			if _, err = tc.store.Edit(1, "1-6", "reply, edited", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			tombstone, err := tc.store.Delete(1, "1-6", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, _ := tc.store.Get(1, "1-6")
+			for _, evt := range []models.ChatEvent{tombstone, stored} {
+				if evt.Msg != "" || len(evt.Mentions) != 0 || len(evt.Attachments) != 0 {
+					t.Errorf("Unexpected tombstone %+v", evt)
+				}
+			}
+			if revisions, _ := tc.store.Revisions(1, "1-6"); len(revisions) != 0 {
+				t.Errorf("Expected revisions of a deleted message to be dropped, got %+v", revisions)
+			}
+			if err := tc.store.Purge(2); err != nil {
+				t.Fatal(err)
+			}
+			if purged, _ := tc.store.Recent(2, 100); len(purged) != 0 {
+				t.Errorf("Expected history to be purged, got %+v", purged)
+			}
+		})
+	}
+}
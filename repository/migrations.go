@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// migrations holds the database schema, one entry per version. Never edit an entry once released:
+// append a new one instead so existing databases can be upgraded in place.
+var migrations = []string{
+	// 1: chat rooms
+	`CREATE TABLE rooms (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		title       TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		description TEXT NOT NULL DEFAULT '',
+		visibility  TEXT NOT NULL,
+		password    TEXT NOT NULL DEFAULT '',
+		created_at  TIMESTAMP NOT NULL,
+		updated_at  TIMESTAMP NOT NULL
+	)`,
+	// 2: message history
+	`CREATE TABLE messages (
+		room_id    INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+		seq        INTEGER NOT NULL,
+		event_type TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		color      TEXT NOT NULL DEFAULT '',
+		msg        TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (room_id, seq)
+	)`,
+	// 3: message identity
+	`ALTER TABLE messages ADD COLUMN id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE messages ADD COLUMN client_msg_id TEXT NOT NULL DEFAULT '';
+	CREATE UNIQUE INDEX messages_id ON messages (id) WHERE id != ''`,
+	// 4: message edits and tombstones
+	`ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+	ALTER TABLE messages ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE message_revisions (
+		message_id TEXT NOT NULL,
+		revision   INTEGER NOT NULL,
+		msg        TEXT NOT NULL,
+		edited_at  TIMESTAMP NOT NULL,
+		PRIMARY KEY (message_id, revision)
+	)`,
+	// 5: message reactions
+	`CREATE TABLE message_reactions (
+		message_id TEXT NOT NULL,
+		emoji      TEXT NOT NULL,
+		name       TEXT NOT NULL COLLATE NOCASE,
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (message_id, emoji, name)
+	)`,
+	// 6: threaded replies
+	`ALTER TABLE messages ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX messages_parent ON messages (parent_id) WHERE parent_id != ''`,
+	// 7: direct messages
+	`CREATE TABLE direct_messages (
+		id            TEXT PRIMARY KEY,
+		room_id       INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+		client_msg_id TEXT NOT NULL DEFAULT '',
+		name          TEXT NOT NULL COLLATE NOCASE,
+		color         TEXT NOT NULL DEFAULT '',
+		msg           TEXT NOT NULL,
+		created_at    TIMESTAMP NOT NULL
+	);
+	CREATE INDEX direct_messages_room ON direct_messages (room_id, name);
+	CREATE TABLE direct_message_recipients (
+		message_id TEXT NOT NULL REFERENCES direct_messages (id) ON DELETE CASCADE,
+		name       TEXT NOT NULL COLLATE NOCASE,
+		PRIMARY KEY (message_id, name)
+	)`,
+	// 8: mentions, stored as a JSON array
+	`ALTER TABLE messages ADD COLUMN mentions TEXT NOT NULL DEFAULT ''`,
+	// 9: read receipts
+	`CREATE TABLE read_receipts (
+		room_id    INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+		name       TEXT NOT NULL COLLATE NOCASE,
+		seq        INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (room_id, name)
+	)`,
+	// 10: attachments, referenced by messages as a JSON array of IDs
+	`CREATE TABLE attachments (
+		id           TEXT PRIMARY KEY,
+		room_id      INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+		name         TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		created_at   TIMESTAMP NOT NULL
+	);
+	ALTER TABLE messages ADD COLUMN attachments TEXT NOT NULL DEFAULT ''`,
+	// 11: user accounts
+	`CREATE TABLE accounts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		username   TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password   TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	// 12: room ownership and roles
+	`ALTER TABLE rooms ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	CREATE TABLE room_roles (
+		room_id  INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+		username TEXT NOT NULL COLLATE NOCASE,
+		role     TEXT NOT NULL,
+		PRIMARY KEY (room_id, username)
+	)`,
+	// 13: bans and mutes, lasting until lifted when until is NULL
+	`CREATE TABLE room_sanctions (
+		room_id  INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+		username TEXT NOT NULL COLLATE NOCASE,
+		kind     TEXT NOT NULL,
+		until    TIMESTAMP,
+		PRIMARY KEY (room_id, username, kind)
+	)`,
+	// 14: tokens revoked before they expire
+	`CREATE TABLE revoked_tokens (
+		jti        TEXT PRIMARY KEY,
+		expires_at TIMESTAMP NOT NULL
+	)`,
+}
+
+// migrate brings the database schema up to date with migrations
+func migrate(db *sql.DB) (err error) {
+	if _, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return
+	}
+	var version int
+	if err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", version+1, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return
+}
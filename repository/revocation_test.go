@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"api_chat/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRevocationLists(t *testing.T) {
+	sqlStore := openTestStore(t, filepath.Join(t.TempDir(), "chitchat.db"))
+	defer sqlStore.Close()
+	defer func(previous config.RevocationList) { config.Revocations = previous }(config.Revocations)
+	cases := []struct {
+		name string
+		list config.RevocationList
+	}{
+		{"memory", config.NewRevocationLog()},
+		{"sqlite", &SQLRevocationList{Db: sqlStore.Db}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Revocations = tc.list
+			tokens := make([]string, 2)
+			for i := range tokens {
+				tokens[i], _ = config.EncodeSessionJWT("alice", "secret")
+			}
+			claim := &config.Claims{}
+			if err := config.ParseJWT(tokens[0], claim, "secret"); err != nil {
+				t.Fatal(err)
+			}
+			if err := claim.Revoke(); err != nil {
+				t.Fatal(err)
+			}
+			// Revoking twice is harmless
+			if err := claim.Revoke(); err != nil {
+				t.Fatal(err)
+			}
+			if err := config.ParseJWT(tokens[0], &config.Claims{}, "secret"); err == nil || err.(*config.APIError).Code != 404 {
+				t.Errorf("Expected revoked token to be refused, got %v", err)
+			}
+			if err := config.ParseJWT(tokens[1], &config.Claims{}, "secret"); err != nil {
+				t.Errorf("Expected other token to be accepted, got %v", err)
+			}
+			if err := tc.list.Revoke("expired", time.Now().Add(-time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.list.Prune(time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if revoked, _ := tc.list.IsRevoked("expired"); revoked {
+				t.Error("Expected expired entry to be pruned")
+			}
+			if revoked, _ := tc.list.IsRevoked(claim.Id); !revoked {
+				t.Error("Expected unexpired entry to be kept")
+			}
+		})
+	}
+}
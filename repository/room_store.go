@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"api_chat/models"
+	"time"
+)
+
+// RoomStore maintains ChatRooms. Handlers are given a RoomStore at construction time
+// so the backing storage can be swapped without touching them.
+type RoomStore interface {
+	// Add will validate a new chat room and add it to the store
+	Add(cr *models.ChatRoom) error
+	// Retrieve returns a single chat room based on title or ID
+	Retrieve(titleOrID string) (*models.ChatRoom, error)
+	// RetrieveID returns a single chat room based on ID
+	RetrieveID(ID int) (*models.ChatRoom, error)
+	// Update a chat room. NOTE: Authorization should have been done before calling this
+	Update(titleOrID string, modifiedChatRoom *models.ChatRoom) error
+	// UpdatePassword replaces the password of a private or hidden chat room. NOTE: Authorization should have been done before calling this
+	UpdatePassword(cr *models.ChatRoom, password string) error
+	// SetRole grants a role to a registered user of a chat room. NOTE: Authorization should have been done before calling this
+	SetRole(cr *models.ChatRoom, username string, role string) error
+	// Sanction bans or mutes a user of a chat room until the given time, or until lifted if it is zero.
+	// NOTE: Authorization should have been done before calling this
+	Sanction(cr *models.ChatRoom, kind string, username string, until time.Time) error
+	// Lift ends a ban or mute of a user of a chat room
+	Lift(cr *models.ChatRoom, kind string, username string) error
+	// Delete a chat room
+	Delete(cr *models.ChatRoom) error
+	// Chats will return all non-hidden ChatRooms
+	Chats() ([]models.ChatRoom, error)
+}
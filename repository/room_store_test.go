@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomStoresUpdate(t *testing.T) {
+	sqlStore := openTestStore(t, filepath.Join(t.TempDir(), "chitchat.db"))
+	defer sqlStore.Close()
+	cs := NewChatServer()
+	cs.Init()
+	cases := []struct {
+		name  string
+		store RoomStore
+	}{
+		{"memory", cs},
+		{"sqlite", sqlStore},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.store.Add(&models.ChatRoom{Title: "private room", Type: "private", Password: "password123"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.store.Sanction(mustRetrieve(t, tc.store, "private room"), models.Ban, "mallory", time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.store.Sanction(mustRetrieve(t, tc.store, "private room"), models.Mute, "trent", time.Time{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.store.Update("private room", &models.ChatRoom{Title: "renamed room", Description: "renamed", Type: "Hidden"}); err != nil {
+				t.Fatal("Error updating room", err)
+			}
+			cr := mustRetrieve(t, tc.store, "renamed room")
+			if cr.Type != models.HiddenRoom || cr.Description != "renamed" || !features.MatchesPassword("password123", *cr) {
+				t.Errorf("Unexpected updated room %+v", cr)
+			}
+			if !features.IsBanned(cr, "mallory") || !features.IsMuted(cr, "trent") {
+				t.Error("Expected the updated room to keep its sanctions")
+			}
+			// Titles stay unique, ignoring case
+			if err := tc.store.Add(&models.ChatRoom{Title: "other room", Type: "public"}); err != nil {
+				t.Fatal(err)
+			}
+			err := tc.store.Update("renamed room", &models.ChatRoom{Title: "Other Room", Type: "Hidden"})
+			if apierr, ok := err.(*config.APIError); !ok || apierr.Code != 102 || apierr.Field != "title" {
+				t.Errorf("Expected duplicate title to be refused, got %v", err)
+			}
+			if _, err := tc.store.Retrieve("renamed room"); err != nil {
+				t.Error("Expected the refused update to keep the room", err)
+			}
+			// The updated room keeps its history
+			evt := &models.ChatEvent{User: "alice", Msg: "hi", ID: features.NewEventID(), Timestamp: time.Now()}
+			if err := features.Send(evt, cr); err != nil {
+				t.Fatal("Error sending after update", err)
+			}
+			c := &models.Client{Username: "bob", Room: cr, Outbox: models.NewOutbox(10, models.DropOldest)}
+			cr.Broker.OpenClient <- c
+			features.Replay(c)
+			select {
+			case <-c.Outbox.Ready():
+				if replayed := c.Outbox.Drain(); len(replayed) == 0 {
+					t.Error("Expected history to be replayed")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("History was not replayed")
+			}
+			// and its direct messages
+			dm := &models.ChatEvent{EventType: models.DirectMessage, User: "alice", Recipients: []string{"bob"}, RoomID: cr.ID,
+				Msg: "psst", ID: features.NewEventID(), Timestamp: time.Now()}
+			if err := cr.Conversations.Append(dm); err != nil {
+				t.Fatal("Error sending a direct message after update", err)
+			}
+			if dms, err := cr.Conversations.Recent(cr.ID, "bob", 10); err != nil || len(dms) != 1 {
+				t.Errorf("Expected 1 direct message, got %d (%v)", len(dms), err)
+			}
+			// and its attachments
+			a := &models.Attachment{ID: features.NewEventID(), RoomID: cr.ID, Name: "notes.txt", ContentType: "text/plain", CreatedAt: time.Now()}
+			if err := cr.Attachments.Add(a, strings.NewReader("hello")); err != nil {
+				t.Fatal("Error uploading after update", err)
+			}
+			if _, err := cr.Attachments.Get(cr.ID, a.ID); err != nil {
+				t.Error("Expected attachment to be stored", err)
+			}
+		})
+	}
+}
+
+func TestRoomAccessWhileSanctioning(t *testing.T) {
+	cs := NewChatServer()
+	cs.Init()
+	if err := cs.Add(&models.ChatRoom{Title: "busy room", Type: "public"}); err != nil {
+		t.Fatal(err)
+	}
+	cr := mustRetrieve(t, cs, "busy room")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprint("user", i)
+			cs.Sanction(cr, models.Mute, name, time.Time{})
+			cs.SetRole(cr, name, models.Moderator)
+			cs.Lift(cr, models.Mute, name)
+		}
+	}()
+	// Readers must never see the maps being changed, which the race detector reports
+	for i := 0; i < 100; i++ {
+		features.RoleOf(cr, "user1")
+		features.IsMuted(cr, "user1")
+		features.IsBanned(cr, "user1")
+		features.ToJSON(*cr)
+		cs.Chats()
+	}
+	<-done
+}
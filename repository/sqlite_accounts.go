@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLAccountStore is an AccountStore persisting accounts to the SQLite database of a SQLStore
+type SQLAccountStore struct {
+	Db *sql.DB
+}
+
+// Register will validate a new account, hash its password and add it to the store
+func (as *SQLAccountStore) Register(a *models.Account) (err error) {
+	if apierr, valid := features.IsValidAccount(*a); !valid {
+		return apierr
+	}
+	if err = prepareAccount(a); err != nil {
+		return
+	}
+	res, err := as.Db.Exec("INSERT INTO accounts (username, password, created_at) VALUES (?, ?, ?)", a.Username, a.Password, a.CreatedAt)
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return &config.APIError{
+			Code:  202,
+			Field: "username",
+		}
+	} else if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	a.ID = int(id)
+	return
+}
+
+// Retrieve returns the account of a username, ignoring case
+func (as *SQLAccountStore) Retrieve(username string) (a models.Account, err error) {
+	err = as.Db.QueryRow("SELECT id, username, password, created_at FROM accounts WHERE username = ?", username).
+		Scan(&a.ID, &a.Username, &a.Password, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		err = &config.APIError{
+			Code:  201,
+			Field: username,
+		}
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"api_chat/storage"
+	"database/sql"
+	"io"
+)
+
+// SQLAttachmentStore is an AttachmentStore persisting the metadata of attachments to the SQLite database
+// of a SQLStore. The content of attachments is kept in Blobs.
+type SQLAttachmentStore struct {
+	Db    *sql.DB
+	Blobs storage.Blobs
+}
+
+// Add stores a new attachment with the content read from r and sets its Size
+func (as *SQLAttachmentStore) Add(a *models.Attachment, r io.Reader) (err error) {
+	if a.Size, err = as.Blobs.Put(a.ID, r); err != nil {
+		return
+	}
+	if _, err = as.Db.Exec("INSERT INTO attachments (id, room_id, name, content_type, size, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		a.ID, a.RoomID, a.Name, a.ContentType, a.Size, a.CreatedAt); err != nil {
+		// Do not keep content nothing refers to
+		as.Blobs.Delete(a.ID)
+	}
+	return
+}
+
+// Get returns the attachment of a room by ID
+func (as *SQLAttachmentStore) Get(roomID int, id string) (a models.Attachment, err error) {
+	err = as.Db.QueryRow("SELECT id, room_id, name, content_type, size, created_at FROM attachments WHERE room_id = ? AND id = ?", roomID, id).
+		Scan(&a.ID, &a.RoomID, &a.Name, &a.ContentType, &a.Size, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		err = &config.APIError{Code: 108, Field: id}
+	}
+	return
+}
+
+// Open returns the attachment of a room by ID along with its content
+func (as *SQLAttachmentStore) Open(roomID int, id string) (models.Attachment, io.ReadCloser, error) {
+	a, err := as.Get(roomID, id)
+	if err != nil {
+		return a, nil, err
+	}
+	content, err := as.Blobs.Open(id)
+	return a, content, err
+}
+
+// Purge removes the attachments of a room
+func (as *SQLAttachmentStore) Purge(roomID int) error {
+	rows, err := as.Db.Query("SELECT id FROM attachments WHERE room_id = ?", roomID)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if err = as.Blobs.Delete(id); err != nil {
+			return err
+		}
+	}
+	_, err = as.Db.Exec("DELETE FROM attachments WHERE room_id = ?", roomID)
+	return err
+}
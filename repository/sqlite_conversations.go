@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"api_chat/models"
+	"database/sql"
+	"strings"
+)
+
+// SQLConversationStore is a ConversationStore persisting direct messages to the SQLite database of a SQLStore
+type SQLConversationStore struct {
+	Db *sql.DB
+}
+
+// Append stores a direct message from its sender to its Recipients
+func (cs *SQLConversationStore) Append(evt *models.ChatEvent) (err error) {
+	tx, err := cs.Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("INSERT INTO direct_messages (id, room_id, client_msg_id, name, color, msg, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		evt.ID, evt.RoomID, evt.ClientMsgID, evt.User, evt.Color, evt.Msg, evt.Timestamp); err != nil {
+		return
+	}
+	for _, name := range evt.Recipients {
+		if _, err = tx.Exec("INSERT OR IGNORE INTO direct_message_recipients (message_id, name) VALUES (?, ?)", evt.ID, name); err != nil {
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// Recent returns up to n of the latest direct messages of a room sent or received by user, oldest first
+func (cs *SQLConversationStore) Recent(roomID int, user string, n int) (events []models.ChatEvent, err error) {
+	rows, err := cs.Db.Query(`SELECT id, room_id, client_msg_id, name, color, msg, created_at FROM direct_messages
+		WHERE room_id = ? AND (name = ? OR id IN (SELECT message_id FROM direct_message_recipients WHERE name = ?))
+		ORDER BY created_at DESC, rowid DESC LIMIT ?`, roomID, user, user, n)
+	if err != nil {
+		return
+	}
+	if events, err = scanDirectMessages(rows); err != nil || len(events) == 0 {
+		return
+	}
+	// Flip to chronological order
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, cs.attachRecipients(events)
+}
+
+// attachRecipients loads the Recipients of events
+func (cs *SQLConversationStore) attachRecipients(events []models.ChatEvent) error {
+	byID, args := messageIDs(events)
+	rows, err := cs.Db.Query("SELECT message_id, name FROM direct_message_recipients WHERE message_id IN (?"+
+		strings.Repeat(", ?", len(args)-1)+") ORDER BY rowid", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		if err = rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		byID[id].Recipients = append(byID[id].Recipients, name)
+	}
+	return rows.Err()
+}
+
+// Purge removes the direct messages of a room
+func (cs *SQLConversationStore) Purge(roomID int) (err error) {
+	_, err = cs.Db.Exec("DELETE FROM direct_messages WHERE room_id = ?", roomID)
+	return
+}
+
+func scanDirectMessages(rows *sql.Rows) (events []models.ChatEvent, err error) {
+	defer rows.Close()
+	events = make([]models.ChatEvent, 0)
+	for rows.Next() {
+		evt := models.ChatEvent{EventType: models.DirectMessage}
+		if err = rows.Scan(&evt.ID, &evt.RoomID, &evt.ClientMsgID, &evt.User, &evt.Color, &evt.Msg, &evt.Timestamp); err != nil {
+			return
+		}
+		events = append(events, evt)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,380 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/models"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+)
+
+// messageColumns are the columns scanned by scanMessages
+const messageColumns = "room_id, seq, id, client_msg_id, event_type, name, color, msg, created_at, edited_at, deleted, parent_id, mentions, attachments"
+
+// SQLMessageStore is a MessageStore persisting ChatEvents to the SQLite database of a SQLStore
+type SQLMessageStore struct {
+	Db *sql.DB
+}
+
+// Append stores evt and assigns it the next sequence number of its room
+func (ms *SQLMessageStore) Append(evt *models.ChatEvent) (err error) {
+	tx, err := ms.Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if err = tx.QueryRow("SELECT COALESCE(MAX(seq), 0) + 1 FROM messages WHERE room_id = ?", evt.RoomID).Scan(&evt.Seq); err != nil {
+		return
+	}
+	if _, err = tx.Exec("INSERT INTO messages (room_id, seq, id, client_msg_id, event_type, name, color, msg, created_at, parent_id, mentions, attachments) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		evt.RoomID, evt.Seq, evt.ID, evt.ClientMsgID, evt.EventType, evt.User, evt.Color, evt.Msg, evt.Timestamp, evt.ParentID,
+		jsonList(evt.Mentions), jsonList(evt.Attachments)); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// Recent returns up to n of the latest events of a room, oldest first
+func (ms *SQLMessageStore) Recent(roomID int, n int) (events []models.ChatEvent, err error) {
+	rows, err := ms.Db.Query("SELECT "+messageColumns+" FROM messages WHERE room_id = ? ORDER BY seq DESC LIMIT ?", roomID, n)
+	if err != nil {
+		return
+	}
+	if events, err = scanMessages(rows); err != nil {
+		return
+	}
+	if err = annotate(ms.Db, events); err != nil {
+		return
+	}
+	// Flip to chronological order
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return
+}
+
+// Before returns up to limit events of a room with a sequence number lower than before, newest first
+func (ms *SQLMessageStore) Before(roomID int, before int, limit int) ([]models.ChatEvent, error) {
+	if before <= 0 {
+		before = math.MaxInt32
+	}
+	rows, err := ms.Db.Query("SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND seq < ? ORDER BY seq DESC LIMIT ?", roomID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	return events, annotate(ms.Db, events)
+}
+
+// Since returns up to limit events of a room with a sequence number higher than after, oldest first
+func (ms *SQLMessageStore) Since(roomID int, after int, limit int) ([]models.ChatEvent, error) {
+	rows, err := ms.Db.Query("SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND seq > ? ORDER BY seq LIMIT ?", roomID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	return events, annotate(ms.Db, events)
+}
+
+// Get returns a stored message of a room by ID
+func (ms *SQLMessageStore) Get(roomID int, id string) (models.ChatEvent, error) {
+	return ms.get(ms.Db, roomID, id)
+}
+
+// Edit replaces the text of a stored message, keeping the previous one as a Revision
+func (ms *SQLMessageStore) Edit(roomID int, id string, msg string, at time.Time) (evt models.ChatEvent, err error) {
+	tx, err := ms.Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if evt, err = ms.get(tx, roomID, id); err != nil {
+		return
+	}
+	if evt.Deleted {
+		return evt, &config.APIError{Code: 107, Field: id}
+	}
+	if _, err = tx.Exec("INSERT INTO message_revisions (message_id, revision, msg, edited_at) SELECT ?, COUNT(*) + 1, ?, ? FROM message_revisions WHERE message_id = ?",
+		id, evt.Msg, at, id); err != nil {
+		return
+	}
+	if _, err = tx.Exec("UPDATE messages SET msg = ?, edited_at = ? WHERE id = ?", msg, at, id); err != nil {
+		return
+	}
+	evt.Msg = msg
+	evt.EditedAt = &at
+	return evt, tx.Commit()
+}
+
+// Delete turns a stored message into a tombstone
+func (ms *SQLMessageStore) Delete(roomID int, id string, at time.Time) (evt models.ChatEvent, err error) {
+	tx, err := ms.Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if evt, err = ms.get(tx, roomID, id); err != nil {
+		return
+	}
+	if evt.Deleted {
+		return evt, &config.APIError{Code: 107, Field: id}
+	}
+	if _, err = tx.Exec("UPDATE messages SET msg = '', mentions = '', attachments = '', deleted = 1, edited_at = ? WHERE id = ?", at, id); err != nil {
+		return
+	}
+	if _, err = tx.Exec("DELETE FROM message_reactions WHERE message_id = ?", id); err != nil {
+		return
+	}
+	if _, err = tx.Exec("DELETE FROM message_revisions WHERE message_id = ?", id); err != nil {
+		return
+	}
+	evt.Msg = ""
+	evt.Mentions = nil
+	evt.Attachments = nil
+	evt.Reactions = nil
+	evt.Deleted = true
+	evt.EditedAt = &at
+	return evt, tx.Commit()
+}
+
+// Revisions returns the previous texts of a message, oldest first
+func (ms *SQLMessageStore) Revisions(roomID int, id string) (revisions []models.Revision, err error) {
+	if _, err = ms.Get(roomID, id); err != nil {
+		return
+	}
+	rows, err := ms.Db.Query("SELECT msg, edited_at FROM message_revisions WHERE message_id = ? ORDER BY revision", id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	revisions = make([]models.Revision, 0)
+	for rows.Next() {
+		var rev models.Revision
+		if err = rows.Scan(&rev.Msg, &rev.EditedAt); err != nil {
+			return
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (ms *SQLMessageStore) get(q querier, roomID int, id string) (evt models.ChatEvent, err error) {
+	rows, err := q.Query("SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND id = ?", roomID, id)
+	if err != nil {
+		return
+	}
+	events, err := scanMessages(rows)
+	if err != nil {
+		return
+	}
+	if len(events) == 0 {
+		return evt, &config.APIError{Code: 107, Field: id}
+	}
+	return events[0], annotate(q, events)
+}
+
+// React attaches an emoji of a user to a stored message
+func (ms *SQLMessageStore) React(roomID int, id string, emoji string, user string) (err error) {
+	tx, err := ms.Db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	evt, err := ms.get(tx, roomID, id)
+	if err != nil {
+		return
+	}
+	if evt.Deleted {
+		return &config.APIError{Code: 107, Field: id}
+	}
+	if _, err = tx.Exec("INSERT OR IGNORE INTO message_reactions (message_id, emoji, name, created_at) VALUES (?, ?, ?, ?)",
+		id, emoji, user, time.Now()); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// Unreact removes an emoji of a user from a stored message
+func (ms *SQLMessageStore) Unreact(roomID int, id string, emoji string, user string) (err error) {
+	if _, err = ms.Get(roomID, id); err != nil {
+		return
+	}
+	_, err = ms.Db.Exec("DELETE FROM message_reactions WHERE message_id = ? AND emoji = ? AND name = ?", id, emoji, user)
+	return
+}
+
+// MarkRead records that user read the messages of a room up to seq, or up to the latest message if seq is past it
+func (ms *SQLMessageStore) MarkRead(roomID int, user string, seq int) (err error) {
+	_, err = ms.Db.Exec(`INSERT INTO read_receipts (room_id, name, seq, updated_at)
+		VALUES (?, ?, MAX(0, MIN(?, (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE room_id = ?))), ?)
+		ON CONFLICT (room_id, name) DO UPDATE SET seq = MAX(seq, excluded.seq), updated_at = excluded.updated_at`,
+		roomID, user, seq, roomID, time.Now())
+	return
+}
+
+// Unread returns the highest sequence number user read in a room and the number of messages of others after it
+func (ms *SQLMessageStore) Unread(roomID int, user string) (lastRead int, unread int, err error) {
+	if err = ms.Db.QueryRow("SELECT seq FROM read_receipts WHERE room_id = ? AND name = ?", roomID, user).Scan(&lastRead); err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = ms.Db.QueryRow("SELECT COUNT(*) FROM messages WHERE room_id = ? AND seq > ? AND deleted = 0 AND name != ? COLLATE NOCASE",
+		roomID, lastRead, user).Scan(&unread)
+	return
+}
+
+// Thread returns the replies to a stored message, oldest first
+func (ms *SQLMessageStore) Thread(roomID int, id string) ([]models.ChatEvent, error) {
+	if _, err := ms.Get(roomID, id); err != nil {
+		return nil, err
+	}
+	rows, err := ms.Db.Query("SELECT "+messageColumns+" FROM messages WHERE room_id = ? AND parent_id = ? ORDER BY seq", roomID, id)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	return events, annotate(ms.Db, events)
+}
+
+// annotate attaches the reactions and the thread summary to events
+func annotate(q querier, events []models.ChatEvent) error {
+	if err := attachReactions(q, events); err != nil {
+		return err
+	}
+	return attachReplies(q, events)
+}
+
+// attachReplies counts the replies to events and finds the latest one
+func attachReplies(q querier, events []models.ChatEvent) error {
+	byID, args := messageIDs(events)
+	if len(args) == 0 {
+		return nil
+	}
+	rows, err := q.Query("SELECT parent_id, created_at FROM messages WHERE parent_id IN (?"+
+		strings.Repeat(", ?", len(args)-1)+") ORDER BY seq", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err = rows.Scan(&id, &at); err != nil {
+			return err
+		}
+		evt := byID[id]
+		evt.ReplyCount++
+		evt.LastReplyAt = &at
+	}
+	return rows.Err()
+}
+
+// messageIDs indexes events by ID and returns the IDs as query arguments
+func messageIDs(events []models.ChatEvent) (map[string]*models.ChatEvent, []interface{}) {
+	byID := make(map[string]*models.ChatEvent, len(events))
+	args := make([]interface{}, 0, len(events))
+	for i := range events {
+		if events[i].ID != "" {
+			byID[events[i].ID] = &events[i]
+			args = append(args, events[i].ID)
+		}
+	}
+	return byID, args
+}
+
+// attachReactions loads the reactions of events, in the order they were added
+func attachReactions(q querier, events []models.ChatEvent) error {
+	byID, args := messageIDs(events)
+	if len(args) == 0 {
+		return nil
+	}
+	rows, err := q.Query("SELECT message_id, emoji, name FROM message_reactions WHERE message_id IN (?"+
+		strings.Repeat(", ?", len(args)-1)+") ORDER BY created_at, rowid", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, emoji, name string
+		if err = rows.Scan(&id, &emoji, &name); err != nil {
+			return err
+		}
+		evt := byID[id]
+		if evt.Reactions == nil {
+			evt.Reactions = make(map[string][]string)
+		}
+		evt.Reactions[emoji] = append(evt.Reactions[emoji], name)
+	}
+	return rows.Err()
+}
+
+// Purge removes the history of a room
+func (ms *SQLMessageStore) Purge(roomID int) (err error) {
+	if _, err = ms.Db.Exec("DELETE FROM message_revisions WHERE message_id IN (SELECT id FROM messages WHERE room_id = ?)", roomID); err != nil {
+		return
+	}
+	if _, err = ms.Db.Exec("DELETE FROM message_reactions WHERE message_id IN (SELECT id FROM messages WHERE room_id = ?)", roomID); err != nil {
+		return
+	}
+	if _, err = ms.Db.Exec("DELETE FROM read_receipts WHERE room_id = ?", roomID); err != nil {
+		return
+	}
+	_, err = ms.Db.Exec("DELETE FROM messages WHERE room_id = ?", roomID)
+	return
+}
+
+func scanMessages(rows *sql.Rows) (events []models.ChatEvent, err error) {
+	defer rows.Close()
+	events = make([]models.ChatEvent, 0)
+	for rows.Next() {
+		var evt models.ChatEvent
+		var editedAt sql.NullTime
+		var mentions, attachments string
+		if err = rows.Scan(&evt.RoomID, &evt.Seq, &evt.ID, &evt.ClientMsgID, &evt.EventType, &evt.User, &evt.Color, &evt.Msg, &evt.Timestamp, &editedAt, &evt.Deleted, &evt.ParentID,
+			&mentions, &attachments); err != nil {
+			return
+		}
+		if evt.Mentions, err = parseJSONList(mentions); err != nil {
+			return
+		}
+		if evt.Attachments, err = parseJSONList(attachments); err != nil {
+			return
+		}
+		if editedAt.Valid {
+			evt.EditedAt = &editedAt.Time
+		}
+		events = append(events, evt)
+	}
+	return events, rows.Err()
+}
+
+// jsonList encodes a list of strings stored in a single column, empty lists are stored as ""
+func jsonList(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+func parseJSONList(data string) (list []string, err error) {
+	if data != "" {
+		err = json.Unmarshal([]byte(data), &list)
+	}
+	return
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQLRevocationList is a config.RevocationList persisting revoked tokens to the SQLite database of an SQLStore,
+// so they stay revoked across restarts
+type SQLRevocationList struct {
+	Db *sql.DB
+}
+
+// Revoke refuses the token with the given ID from now until it expires
+func (l *SQLRevocationList) Revoke(jti string, expiresAt time.Time) (err error) {
+	_, err = l.Db.Exec(`INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?)
+		ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	return
+}
+
+// IsRevoked reports whether the token with the given ID was revoked
+func (l *SQLRevocationList) IsRevoked(jti string) (revoked bool, err error) {
+	err = l.Db.QueryRow("SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked)
+	return
+}
+
+// Prune drops the entries of tokens expired at now
+func (l *SQLRevocationList) Prune(now time.Time) (err error) {
+	_, err = l.Db.Exec("DELETE FROM revoked_tokens WHERE expires_at <= ?", now)
+	return
+}
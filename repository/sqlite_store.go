@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"api_chat/pubsub"
+	"api_chat/storage"
+	"database/sql"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLStore is a RoomStore persisting ChatRooms to an embedded SQLite database.
+// Live rooms (with their Broker and Clients) are kept in an in-memory ChatServer acting as a write-through cache.
+type SQLStore struct {
+	Db    *sql.DB
+	cache *ChatServer
+}
+
+// OpenSQLStore opens (or creates) the SQLite database at path, migrates it and loads all stored rooms.
+// The Brokers of the rooms are connected to bus, the content of attachments is kept in blobs.
+func OpenSQLStore(path string, bus pubsub.Bus, blobs storage.Blobs) (store *SQLStore, err error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return
+	}
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+	if err = migrate(db); err != nil {
+		db.Close()
+		return
+	}
+	store = &SQLStore{Db: db, cache: NewChatServer()}
+	store.cache.Messages = &SQLMessageStore{Db: db}
+	store.cache.Conversations = &SQLConversationStore{Db: db}
+	store.cache.Attachments = &SQLAttachmentStore{Db: db, Blobs: blobs}
+	store.cache.Bus = bus
+	if err = store.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return
+}
+
+// Init will seed a fresh database with the default public room.
+func (s *SQLStore) Init() (err error) {
+	s.cache.mu.RLock()
+	seeded := len(s.cache.RoomsID) > 0
+	s.cache.mu.RUnlock()
+	if seeded {
+		return
+	}
+	return s.Add(&models.ChatRoom{
+		Title:       "Public Chat",
+		Description: "This is the default chat, available to everyone!",
+		Type:        models.PublicRoom,
+	})
+}
+
+// Close closes the underlying database
+func (s *SQLStore) Close() error {
+	return s.Db.Close()
+}
+
+func (s *SQLStore) load() (err error) {
+	rows, err := s.Db.Query("SELECT id, title, description, visibility, password, owner, created_at, updated_at FROM rooms ORDER BY id")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	for rows.Next() {
+		cr := &models.ChatRoom{}
+		if err = rows.Scan(&cr.ID, &cr.Title, &cr.Description, &cr.Type, &cr.Password, &cr.Owner, &cr.CreatedAt, &cr.UpdatedAt); err != nil {
+			return
+		}
+		s.cache.attach(cr)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if err = s.loadRoles(); err != nil {
+		return
+	}
+	return s.loadSanctions()
+}
+
+// loadRoles restores the roles granted in the rooms of the cache
+func (s *SQLStore) loadRoles() (err error) {
+	rows, err := s.Db.Query("SELECT room_id, username, role FROM room_roles")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roomID int
+		var username, role string
+		if err = rows.Scan(&roomID, &username, &role); err != nil {
+			return
+		}
+		if cr, ok := s.cache.RoomsID[roomID]; ok {
+			cr.Grant(username, role)
+		}
+	}
+	return rows.Err()
+}
+
+// loadSanctions restores the bans and mutes of the rooms of the cache, dropping the expired ones
+func (s *SQLStore) loadSanctions() (err error) {
+	if _, err = s.Db.Exec("DELETE FROM room_sanctions WHERE until IS NOT NULL AND until <= ?", time.Now()); err != nil {
+		return
+	}
+	rows, err := s.Db.Query("SELECT room_id, username, kind, until FROM room_sanctions")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roomID int
+		var username, kind string
+		var until sql.NullTime
+		if err = rows.Scan(&roomID, &username, &kind, &until); err != nil {
+			return
+		}
+		if cr, ok := s.cache.RoomsID[roomID]; ok {
+			cr.Sanction(kind, username, &until.Time)
+		}
+	}
+	return rows.Err()
+}
+
+// Chats will return all non-hidden ChatRooms
+func (s *SQLStore) Chats() ([]models.ChatRoom, error) {
+	return s.cache.Chats()
+}
+
+// Retrieve returns a single chat room based on title or ID
+func (s *SQLStore) Retrieve(titleOrID string) (*models.ChatRoom, error) {
+	return s.cache.Retrieve(titleOrID)
+}
+
+// RetrieveID returns a single chat room based on ID. NOTE: This has no error handling unlike s.Retrieve()
+func (s *SQLStore) RetrieveID(ID int) (*models.ChatRoom, error) {
+	return s.cache.RetrieveID(ID)
+}
+
+// Add will create a new chat room, store it and add it to the server
+func (s *SQLStore) Add(cr *models.ChatRoom) (err error) {
+	if rapier, valid := features.IsValid(*cr); !valid {
+		return rapier
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if s.cache.roomExists(cr.Title) {
+		return &config.APIError{
+			Code:  102,
+			Field: "title",
+		}
+	}
+	if err = prepare(cr); err != nil {
+		return
+	}
+	res, err := s.Db.Exec("INSERT INTO rooms (title, description, visibility, password, owner, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		cr.Title, cr.Description, cr.Type, cr.Password, cr.Owner, cr.CreatedAt, cr.UpdatedAt)
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+	cr.ID = int(id)
+	s.cache.attach(cr)
+	return
+}
+
+// Update a chat room. NOTE: Authorization should have been done before calling this
+func (s *SQLStore) Update(titleOrID string, modifiedChatRoom *models.ChatRoom) (err error) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	currentChatRoom, err := s.cache.retrieve(titleOrID)
+	if err != nil {
+		return
+	}
+	if err = prepareUpdate(currentChatRoom, modifiedChatRoom); err != nil {
+		return
+	}
+	if _, err = s.Db.Exec("UPDATE rooms SET title = ?, description = ?, visibility = ?, updated_at = ? WHERE id = ?",
+		modifiedChatRoom.Title, modifiedChatRoom.Description, modifiedChatRoom.Type, modifiedChatRoom.UpdatedAt, modifiedChatRoom.ID); err != nil {
+		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return &config.APIError{
+				Code:  102,
+				Field: "title",
+			}
+		}
+		return
+	}
+	s.cache.replace(currentChatRoom, modifiedChatRoom)
+	return
+}
+
+// UpdatePassword replaces the password of a private or hidden chat room. NOTE: Authorization should have been done before calling this
+func (s *SQLStore) UpdatePassword(cr *models.ChatRoom, password string) (err error) {
+	hash, err := preparePassword(cr, password)
+	if err != nil {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	updatedAt := time.Now()
+	if _, err = s.Db.Exec("UPDATE rooms SET password = ?, updated_at = ? WHERE id = ?", hash, updatedAt, cr.ID); err != nil {
+		return
+	}
+	cr.Password = hash
+	cr.UpdatedAt = updatedAt
+	return
+}
+
+// SetRole grants a role to a registered user of a chat room. NOTE: Authorization should have been done before calling this
+func (s *SQLStore) SetRole(cr *models.ChatRoom, username string, role string) (err error) {
+	if err = features.IsValidRole(cr, username, role); err != nil {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if role == models.Member {
+		_, err = s.Db.Exec("DELETE FROM room_roles WHERE room_id = ? AND username = ?", cr.ID, username)
+	} else {
+		_, err = s.Db.Exec(`INSERT INTO room_roles (room_id, username, role) VALUES (?, ?, ?)
+			ON CONFLICT (room_id, username) DO UPDATE SET role = excluded.role`, cr.ID, username, role)
+	}
+	if err != nil {
+		return
+	}
+	cr.Grant(username, role)
+	return
+}
+
+// Sanction bans or mutes a user of a chat room until the given time, or until lifted if it is zero.
+// NOTE: Authorization should have been done before calling this
+func (s *SQLStore) Sanction(cr *models.ChatRoom, kind string, username string, until time.Time) (err error) {
+	if err = features.IsValidSanction(kind, until); err != nil {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	end := sql.NullTime{Time: until, Valid: !until.IsZero()}
+	if _, err = s.Db.Exec(`INSERT INTO room_sanctions (room_id, username, kind, until) VALUES (?, ?, ?, ?)
+		ON CONFLICT (room_id, username, kind) DO UPDATE SET until = excluded.until`, cr.ID, username, kind, end); err != nil {
+		return
+	}
+	cr.Sanction(kind, username, &until)
+	return
+}
+
+// Lift ends a ban or mute of a user of a chat room
+func (s *SQLStore) Lift(cr *models.ChatRoom, kind string, username string) (err error) {
+	if err = features.IsValidSanction(kind, time.Time{}); err != nil {
+		return
+	}
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if _, err = s.Db.Exec("DELETE FROM room_sanctions WHERE room_id = ? AND username = ? AND kind = ?", cr.ID, username, kind); err != nil {
+		return
+	}
+	cr.Sanction(kind, username, nil)
+	return
+}
+
+// Delete a chat room
+func (s *SQLStore) Delete(cr *models.ChatRoom) (err error) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	s.cache.purge(cr.ID)
+	if _, err = s.Db.Exec("DELETE FROM rooms WHERE id = ?", cr.ID); err != nil {
+		return
+	}
+	s.cache.pop(cr.Title, cr.ID)
+	return
+}
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"api_chat/config"
+	"api_chat/features"
+	"api_chat/models"
+	"api_chat/pubsub"
+	"api_chat/storage"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, path string) *SQLStore {
+	t.Helper()
+	store, err := OpenSQLStore(path, pubsub.NewLocal(), storage.NewMemory())
+	if err != nil {
+		t.Fatal("Error opening store", err)
+	}
+	if err = store.Init(); err != nil {
+		t.Fatal("Error initializing store", err)
+	}
+	return store
+}
+
+func TestSQLStorePersistsRooms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chitchat.db")
+	store := openTestStore(t, path)
+	cases := []struct {
+		title      string
+		visibility string
+		password   string
+	}{
+		{"public room", "public", ""},
+		{"private room", "private", "password123"},
+		{"secret room", "hidden", "!!123abcpassword"},
+	}
+	for _, tc := range cases {
+		if err := store.Add(&models.ChatRoom{Title: tc.title, Description: "persisted", Type: tc.visibility, Password: tc.password}); err != nil {
+			t.Fatalf("Error adding %s: %s", tc.title, err)
+		}
+	}
+	if err := store.Add(&models.ChatRoom{Title: "Public Room", Type: "public"}); err == nil {
+		t.Error("Expected duplicate room to fail")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen to ensure rooms survived
+	store = openTestStore(t, path)
+	defer store.Close()
+	if cr, err := store.Retrieve("1"); err != nil || cr.Title != "Public Chat" {
+		t.Errorf("Expected default room to be seeded exactly once, got %+v (%v)", cr, err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.title, func(t *testing.T) {
+			cr, err := store.Retrieve(tc.title)
+			if err != nil {
+				t.Fatal("Room was not persisted", err)
+			}
+			if cr.Type != tc.visibility || cr.Description != "persisted" || cr.CreatedAt.IsZero() {
+				t.Errorf("Unexpected room %+v", cr)
+			}
+			if tc.password != "" && !features.MatchesPassword(tc.password, *cr) {
+				t.Error("Password hash was not persisted")
+			}
+			if cr.Broker == nil || cr.Clients == nil {
+				t.Error("Room session was not started")
+			}
+		})
+	}
+	rooms, _ := store.Chats()
+	if len(rooms) != 3 {
+		t.Errorf("Expected 3 listed rooms, got %d", len(rooms))
+	}
+}
+
+func TestSQLStoreUpdateDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chitchat.db")
+	store := openTestStore(t, path)
+	if err := store.Add(&models.ChatRoom{Title: "private room", Type: "private", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	cr, _ := store.Retrieve("private room")
+	broker := cr.Broker
+	if err := store.Update("private room", &models.ChatRoom{Title: "renamed room", Description: "renamed", Type: "private"}); err != nil {
+		t.Fatal("Error updating room", err)
+	}
+	if err := store.Update("renamed room", &models.ChatRoom{Title: "Public Chat", Type: "private"}); err == nil || err.(*config.APIError).Code != 102 {
+		t.Errorf("Expected duplicate title error, got %v", err)
+	}
+	if cr.Title != "renamed room" || cr.Broker != broker || !features.MatchesPassword("password123", *cr) {
+		t.Errorf("Live room was not updated in place: %+v", cr)
+	}
+	if err := store.Delete(mustRetrieve(t, store, "1")); err != nil {
+		t.Fatal("Error deleting room", err)
+	}
+	store.Close()
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	if _, err := store.Retrieve("Public Chat"); err == nil {
+		t.Error("Deleted room was restored")
+	}
+	if cr := mustRetrieve(t, store, "renamed room"); cr.Description != "renamed" || !cr.UpdatedAt.After(cr.CreatedAt) {
+		t.Errorf("Update was not persisted: %+v", cr)
+	}
+}
+
+func mustRetrieve(t *testing.T, s RoomStore, titleOrID string) *models.ChatRoom {
+	t.Helper()
+	cr, err := s.Retrieve(titleOrID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cr
+}
+
+func TestSQLStoreRoles(t *testing.T) {
+	features.IsRegistered = func(username string) bool { return username != "nobody" }
+	defer func() { features.IsRegistered = func(string) bool { return false } }()
+	path := filepath.Join(t.TempDir(), "chitchat.db")
+	store := openTestStore(t, path)
+	if err := store.Add(&models.ChatRoom{Title: "owned room", Type: "private", Password: "password123", Owner: "Alice",
+		Roles: map[string]string{"mallory": models.Owner}}); err != nil {
+		t.Fatal(err)
+	}
+	cr := mustRetrieve(t, store, "owned room")
+	for _, grant := range []struct {
+		username     string
+		role         string
+		expectedCode int
+	}{
+		{"Bob", models.Moderator, 0},
+		{"carol", models.ReadOnly, 0},
+		{"dave", models.Moderator, 0},
+		{"DAVE", models.Member, 0},
+		{"erin", models.Owner, 105},
+		{"alice", models.ReadOnly, 104},
+		{"nobody", models.Moderator, 201},
+	} {
+		err := store.SetRole(cr, grant.username, grant.role)
+		if grant.expectedCode == 0 && err != nil {
+			t.Errorf("Error granting %s to %s: %v", grant.role, grant.username, err)
+		} else if grant.expectedCode != 0 && (err == nil || err.(*config.APIError).Code != grant.expectedCode) {
+			t.Errorf("Expected error %d granting %s to %s, got %v", grant.expectedCode, grant.role, grant.username, err)
+		}
+	}
+	if err := store.Update("owned room", &models.ChatRoom{Title: "owned room", Type: "private", Owner: "mallory"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	cr = mustRetrieve(t, store, "owned room")
+	if cr.Owner != "Alice" || len(cr.Roles) != 2 || cr.Roles["bob"] != models.Moderator || cr.Roles["carol"] != models.ReadOnly {
+		t.Errorf("Unexpected ownership %s and roles %+v", cr.Owner, cr.Roles)
+	}
+}
+
+func TestSQLStoreSanctions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chitchat.db")
+	store := openTestStore(t, path)
+	cr := mustRetrieve(t, store, "1")
+	for _, s := range []struct {
+		kind         string
+		username     string
+		until        time.Time
+		expectedCode int
+	}{
+		{models.Ban, "Bob", time.Time{}, 0},
+		{models.Ban, "carol", time.Now().Add(time.Hour), 0},
+		{models.Mute, "dave", time.Now().Add(time.Hour), 0},
+		{models.Mute, "erin", time.Now().Add(time.Hour), 0},
+		{models.Ban, "frank", time.Now().Add(-time.Hour), 105},
+		{models.Kick, "frank", time.Time{}, 105},
+	} {
+		err := store.Sanction(cr, s.kind, s.username, s.until)
+		if s.expectedCode == 0 && err != nil {
+			t.Errorf("Error applying %s to %s: %v", s.kind, s.username, err)
+		} else if s.expectedCode != 0 && (err == nil || err.(*config.APIError).Code != s.expectedCode) {
+			t.Errorf("Expected error %d applying %s to %s, got %v", s.expectedCode, s.kind, s.username, err)
+		}
+	}
+	if err := store.Lift(cr, models.Mute, "ERIN"); err != nil {
+		t.Fatal(err)
+	}
+	if !features.IsBanned(cr, "bob") || !features.IsMuted(cr, "dave") || features.IsMuted(cr, "erin") {
+		t.Errorf("Unexpected bans %+v and mutes %+v", cr.Banned, cr.Muted)
+	}
+	store.Close()
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	cr = mustRetrieve(t, store, "1")
+	if len(cr.Banned) != 2 || !features.IsBanned(cr, "bob") || !features.IsBanned(cr, "Carol") || len(cr.Muted) != 1 || !features.IsMuted(cr, "dave") {
+		t.Errorf("Unexpected bans %+v and mutes %+v", cr.Banned, cr.Muted)
+	}
+	if !cr.Banned["bob"].IsZero() {
+		t.Errorf("Expected the ban of bob to last until lifted, got %s", cr.Banned["bob"])
+	}
+}
+
+func TestSQLStoreUpdatePassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chitchat.db")
+	store := openTestStore(t, path)
+	if err := store.Add(&models.ChatRoom{Title: "private room", Type: "private", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	cr := mustRetrieve(t, store, "private room")
+	for _, change := range []struct {
+		titleOrID     string
+		password      string
+		expectedField string
+	}{
+		{"private room", "short", "password"},
+		{"1", "password456", "visibility"},
+		{"1", "", "visibility"},
+		{"private room", "password456", ""},
+	} {
+		err := store.UpdatePassword(mustRetrieve(t, store, change.titleOrID), change.password)
+		if change.expectedField == "" && err != nil {
+			t.Errorf("Error changing password of %s: %v", change.titleOrID, err)
+		} else if change.expectedField != "" && (err == nil || err.(*config.APIError).Field != change.expectedField) {
+			t.Errorf("Expected invalid %s changing password of %s, got %v", change.expectedField, change.titleOrID, err)
+		}
+	}
+	if features.MatchesPassword("password123", *cr) || !features.MatchesPassword("password456", *cr) {
+		t.Error("Live room password was not changed")
+	}
+	store.Close()
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	if cr = mustRetrieve(t, store, "private room"); !features.MatchesPassword("password456", *cr) {
+		t.Error("Password change was not persisted")
+	}
+	if cr = mustRetrieve(t, store, "1"); cr.Password != "" {
+		t.Error("Public room was given a password")
+	}
+}
+
+func TestSQLStoreDeletePurges(t *testing.T) {
+	blobs := storage.NewMemory()
+	store, err := OpenSQLStore(filepath.Join(t.TempDir(), "chitchat.db"), pubsub.NewLocal(), blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err = store.Add(&models.ChatRoom{Title: "private room", Type: "private", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	cr := mustRetrieve(t, store, "private room")
+	a := &models.Attachment{ID: "01H", RoomID: cr.ID, Name: "notes.txt", ContentType: "text/plain", CreatedAt: time.Now()}
+	if err = cr.Attachments.Add(a, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	evt := &models.ChatEvent{User: "alice", Msg: "hi", RoomID: cr.ID, ID: "01M", Timestamp: time.Now()}
+	if err = cr.Messages.Append(evt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cr.Messages.Edit(cr.ID, "01M", "hello", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = cr.Messages.React(cr.ID, "01M", "👍", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete(cr); err != nil {
+		t.Fatal("Error deleting room", err)
+	}
+	if _, err = blobs.Open("01H"); err == nil {
+		t.Error("Expected the attachment content to be deleted with its room")
+	}
+	for _, table := range []string{"message_revisions", "message_reactions"} {
+		var count int
+		if err = store.Db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("Expected %s to be deleted with their room, %d left", table, count)
+		}
+	}
+}
@@ -2,23 +2,35 @@ package server
 
 import (
 	"api_chat/config"
+	"api_chat/features"
 	"api_chat/handler"
+	"api_chat/models"
+	"api_chat/pubsub"
 	"api_chat/repository"
+	"api_chat/storage"
 	"encoding/json"
 	"log"
-	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // Configuration stores config info of server
 type Configuration struct {
-	Address      string
-	RedisURL     string
-	ReadTimeout  int64
-	WriteTimeout int64
-	Static       string
+	Address        string
+	RedisURL       string
+	Database       string
+	HistoryReplay  int
+	QueueSize      int
+	OverflowPolicy string
+	ReconnectGrace int64
+	Uploads        string
+	MaxUploadSize  int64
+	UploadTypes    []string
+	ReadTimeout    int64
+	WriteTimeout   int64
+	Static         string
 }
 
 // Config captures parsed input from config.json
@@ -29,29 +41,97 @@ var (
 	Mux *mux.Router
 )
 
-// registerHandlers will register all HTTP handlers
-func registerHandlers() *mux.Router {
-	api := mux.NewRouter()
-	//REST-API for chat room [JSON]
-	api.Handle("/chats", handler.ErrHandler(handler.HandlePost)).Methods(http.MethodPost)
-	api.Handle("/chats/{titleOrID}", handler.ErrHandler(handler.Authorize(handler.HandleRoom))).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
-	// Check password matches room
-	api.Handle("/chats/{titleOrID}/token", handler.ErrHandler(handler.Login)).Methods(http.MethodPost)
-	// Check password matches room
-	api.Handle("/chats/{titleOrID}/token/renew", handler.ErrHandler(handler.RenewToken)).Methods(http.MethodGet)
-	// Chat Sessions (WebSocket)
-	// Do not authorize since you can't add headers to WebSockets. We will do authorization when actually receiving chat messages
-	api.Handle("/chats/{titleOrID}/ws", handler.Authorize(handler.WebSocketHandler)).Methods(http.MethodGet)
-	return api
-}
+// Rooms is the RoomStore backing the HTTP handlers
+var Rooms repository.RoomStore
+
+// Accounts is the AccountStore of the registered users
+var Accounts repository.AccountStore
 
 func init() {
 	loadConfig()
 	loadEnvs()
 	loadLog()
+	features.ReplayCount = Config.HistoryReplay
+	features.ReconnectGrace = time.Duration(Config.ReconnectGrace * int64(time.Second))
+	loadQueues()
+	loadUploads()
 	// initialize chat server
-	repository.CS.Init()
-	Mux = registerHandlers()
+	Rooms, Accounts, config.Revocations = loadStores()
+	go config.PruneRevocations(time.Minute)
+	features.IsRegistered = func(username string) bool {
+		_, err := Accounts.Retrieve(username)
+		return err == nil
+	}
+	Mux = handler.NewRouter(handler.NewAPI(Rooms, Accounts))
+}
+
+// loadStores opens the SQLite database configured in config.json. Rooms, accounts and revoked tokens are only kept in memory if none is set.
+func loadStores() (repository.RoomStore, repository.AccountStore, config.RevocationList) {
+	bus := loadBus()
+	blobs := loadBlobs()
+	if Config.Database == "" {
+		cs := repository.NewChatServer()
+		cs.Bus = bus
+		cs.Attachments = repository.NewAttachmentLog(blobs)
+		cs.Init()
+		return cs, repository.NewAccountLog(), config.NewRevocationLog()
+	}
+	store, err := repository.OpenSQLStore(Config.Database, bus, blobs)
+	if err != nil {
+		log.Fatalln("Cannot open database", err)
+	}
+	if err = store.Init(); err != nil {
+		log.Fatalln("Cannot initialize database", err)
+	}
+	return store, &repository.SQLAccountStore{Db: store.Db}, &repository.SQLRevocationList{Db: store.Db}
+}
+
+// loadBus connects to Redis to share room events with other instances. Without a RedisURL, events stay in-process.
+func loadBus() pubsub.Bus {
+	if Config.RedisURL == "" {
+		return pubsub.NewLocal()
+	}
+	bus, err := pubsub.NewRedis(Config.RedisURL)
+	if err != nil {
+		log.Fatalln("Cannot connect to Redis", err)
+	}
+	return bus
+}
+
+// loadBlobs opens the directory attachments are uploaded to. Without one, attachments are only kept in memory.
+func loadBlobs() storage.Blobs {
+	if Config.Uploads == "" {
+		return storage.NewMemory()
+	}
+	blobs, err := storage.NewDisk(Config.Uploads)
+	if err != nil {
+		log.Fatalln("Cannot open uploads directory", err)
+	}
+	return blobs
+}
+
+// loadUploads applies the attachment limits of config.json
+func loadUploads() {
+	if Config.MaxUploadSize > 0 {
+		features.MaxAttachmentSize = Config.MaxUploadSize
+	}
+	if len(Config.UploadTypes) > 0 {
+		features.AttachmentTypes = Config.UploadTypes
+	}
+}
+
+// loadQueues applies the outbound queue settings of config.json to new clients
+func loadQueues() {
+	if Config.QueueSize > 0 {
+		models.QueueSize = Config.QueueSize
+	}
+	switch Config.OverflowPolicy {
+	case "":
+	case models.DropOldest, models.DropNewest, models.Disconnect:
+		models.OverflowPolicy = Config.OverflowPolicy
+	default:
+		log.Fatalln("Unknown overflow policy", Config.OverflowPolicy)
+	}
 }
 
 func loadLog() {
@@ -86,4 +166,13 @@ func loadEnvs() {
 	if key, ok := os.LookupEnv("SECRET_KEY"); ok {
 		handler.SecretKey = key
 	}
+	if path, ok := os.LookupEnv("DATABASE"); ok {
+		Config.Database = path
+	}
+	if url, ok := os.LookupEnv("REDIS_URL"); ok {
+		Config.RedisURL = url
+	}
+	if dir, ok := os.LookupEnv("UPLOADS"); ok {
+		Config.Uploads = dir
+	}
 }
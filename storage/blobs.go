@@ -0,0 +1,20 @@
+// Package storage keeps the content of uploaded files, apart from their metadata.
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when opening a blob that does not exist
+var ErrNotFound = errors.New("storage: blob not found")
+
+// Blobs stores binary content by ID
+type Blobs interface {
+	// Put stores the content read from r under id and returns its size
+	Put(id string, r io.Reader) (int64, error)
+	// Open returns a reader for the content stored under id. The caller must close it.
+	Open(id string) (io.ReadCloser, error)
+	// Delete removes the content stored under id. Deleting a missing blob is not an error.
+	Delete(id string) error
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBlobs(t *testing.T) {
+	disk, err := NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		blobs Blobs
+	}{
+		{"memory", NewMemory()},
+		{"disk", disk},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			size, err := tc.blobs.Put("01H", strings.NewReader("hello"))
+			if err != nil || size != 5 {
+				t.Fatalf("Unexpected result of Put %d (%v)", size, err)
+			}
+			r, err := tc.blobs.Open("01H")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(r)
+			r.Close()
+			if string(content) != "hello" {
+				t.Errorf("Unexpected content %q", content)
+			}
+			if err = tc.blobs.Delete("01H"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = tc.blobs.Open("01H"); err != ErrNotFound {
+				t.Errorf("Expected deleted blob not to be found, got %v", err)
+			}
+			if err = tc.blobs.Delete("01H"); err != nil {
+				t.Errorf("Deleting a missing blob failed: %v", err)
+			}
+		})
+	}
+	if _, err := disk.Put("../escape", strings.NewReader("")); err == nil {
+		t.Error("Expected blob ID with a path to be refused")
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Disk stores blobs as files in a local directory
+type Disk struct {
+	Dir string
+}
+
+// NewDisk returns a Disk storing blobs in dir, which is created if needed
+func NewDisk(dir string) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &Disk{Dir: dir}, nil
+}
+
+// Put stores the content read from r under id and returns its size.
+// The content is written to a temporary file first so readers never see partial blobs.
+func (d *Disk) Put(id string, r io.Reader) (size int64, err error) {
+	path, err := d.path(id)
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(d.Dir, ".upload-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if size, err = io.Copy(tmp, r); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return size, os.Rename(tmp.Name(), path)
+}
+
+// Open returns a reader for the content stored under id
+func (d *Disk) Open(id string) (io.ReadCloser, error) {
+	path, err := d.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the content stored under id
+func (d *Disk) Delete(id string) error {
+	path, err := d.path(id)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path maps id to a file of d.Dir, refusing IDs that would escape it
+func (d *Disk) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("storage: invalid blob ID %q", id)
+	}
+	return filepath.Join(d.Dir, id), nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Memory keeps blobs in memory. Its content is lost when the process exits.
+type Memory struct {
+	blobs map[string][]byte
+	mu    sync.RWMutex
+}
+
+// NewMemory returns an empty in-memory Blobs
+func NewMemory() *Memory {
+	return &Memory{blobs: make(map[string][]byte)}
+}
+
+// Put stores the content read from r under id and returns its size
+func (m *Memory) Put(id string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[id] = data
+	return int64(len(data)), nil
+}
+
+// Open returns a reader for the content stored under id
+func (m *Memory) Open(id string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Delete removes the content stored under id
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, id)
+	return nil
+}